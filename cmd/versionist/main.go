@@ -3,9 +3,14 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -14,14 +19,65 @@ import (
 	"github.com/MovieStoreGuy/versionist/pkg/netrc"
 	"github.com/MovieStoreGuy/versionist/pkg/request"
 	"github.com/MovieStoreGuy/versionist/pkg/resolve"
+	"github.com/MovieStoreGuy/versionist/pkg/toolchain"
+)
+
+const (
+	commandUpdate = "update"
+	commandCheck  = "check"
 )
 
 var (
-	configDir = flag.String("config-path", "", "Defines the path to the manifest file")
+	configDir      = flag.String("config-path", "", "Defines the path to the manifest file")
+	dryRun         = flag.Bool("dry-run", false, "Prints a unified diff of each go.mod change instead of writing it")
+	offline        = flag.Bool("offline", false, "Resolves versions only from the local module cache (GOMODCACHE) without using the network")
+	concurrency    = flag.Int("concurrency", runtime.NumCPU(), "Defines the number of modules and projects resolved from the proxies at once")
+	retries        = flag.Int("retries", request.DefaultRetryPolicy().Attempts-1, "Defines how many times a failed proxy or toolchain listing request is retried")
+	requestTimeout = flag.Duration("request-timeout", request.DefaultRetryPolicy().Timeout, "Defines the timeout of each proxy or toolchain listing request attempt")
+	cacheTTL       = flag.Duration("cache-ttl", 10*time.Minute, "Defines how long proxy responses are cached before being revalidated, zero disables the cache")
+	privateProxy   = flag.String("private-proxy", "", "Defines the proxies, using the GOPROXY format, used for modules matching GONOPROXY or GOPRIVATE instead of resolving them directly")
+	toolchainList  = flag.String("toolchain-listing", toolchain.DefaultListing, "Defines the URL or file of the Go download listing used to resolve the latest toolchain, must be a file when offline")
+	directRepos    = repositoryFlag{}
 )
 
+func init() {
+	flag.Var(directRepos, "direct-repository", "Maps a module path prefix to the git repository used when resolving directly, as `prefix=repository`, can be repeated")
+}
+
+// repositoryFlag maps module path prefixes to git repositories
+type repositoryFlag map[string]string
+
+func (rf repositoryFlag) String() string {
+	prefixes := make([]string, 0, len(rf))
+	for prefix, repo := range rf {
+		prefixes = append(prefixes, prefix+"="+repo)
+	}
+	sort.Strings(prefixes)
+	return strings.Join(prefixes, ",")
+}
+
+func (rf repositoryFlag) Set(value string) error {
+	prefix, repo, ok := strings.Cut(value, "=")
+	if !ok || prefix == "" || repo == "" {
+		return fmt.Errorf("%q must be in the form prefix=repository", value)
+	}
+	rf[strings.TrimSuffix(prefix, "/")] = repo
+	return nil
+}
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [%s|%s]\n", os.Args[0], commandUpdate, commandCheck)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	if flag.NArg() > 1 {
+		// Flags are only parsed before the command, reject
+		// anything after it rather than silently ignoring it.
+		fmt.Fprintf(flag.CommandLine.Output(), "Unexpected arguments after %q: %s\n", flag.Arg(0), strings.Join(flag.Args()[1:], " "))
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
@@ -30,7 +86,20 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	defer log.Sync()
+
+	code := run(ctx, log, flag.Arg(0))
+	_ = log.Sync()
+	cancel()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, log *zap.Logger, command string) int {
+	switch command {
+	case "", commandUpdate, commandCheck:
+	default:
+		flag.Usage()
+		return 2
+	}
 
 	reqOps := []request.FactoryFunc{}
 	if machines, err := netrc.NewMachinesFromEnvironment(); err != nil {
@@ -39,25 +108,93 @@ func main() {
 		reqOps = append(reqOps, request.WithNetrcAuthentication(machines))
 	}
 
+	proxyOps := []goproxy.ClientOptionFunc{
+		goproxy.WithRequestFactory(
+			request.NewRequestFactory(reqOps...),
+		),
+		goproxy.WithGoProxyProxies(goproxy.GoProxiesFromEnvironment(
+			goproxy.WithPrivateProxies(*privateProxy),
+		)),
+		goproxy.WithConcurrency(*concurrency),
+		goproxy.WithRetryPolicy(retryPolicy()),
+	}
+	if len(directRepos) > 0 {
+		proxyOps = append(proxyOps, goproxy.WithDirectRepositories(
+			goproxy.RepositoryPrefixes(directRepos, goproxy.HostedRepository),
+		))
+	}
+	if *cacheTTL > 0 {
+		if dir, err := goproxy.DefaultCacheDir(); err != nil {
+			log.Warn("Failed to find the user cache directory, proxy responses will not be cached", zap.Error(err))
+		} else {
+			proxyOps = append(proxyOps, goproxy.WithResponseCache(goproxy.NewDiskCache(dir), *cacheTTL))
+		}
+	}
+	if *offline {
+		dir, err := goproxy.ModCacheFromEnvironment()
+		if err != nil {
+			log.Error("Failed to find the module cache", zap.Error(err))
+			return 1
+		}
+		proxyOps = append(proxyOps, goproxy.WithOfflineModCache(dir))
+	}
+
+	client := goproxy.NewClient(proxyOps...)
+
 	m, err := manifest.ReadManifest(ctx, *configDir,
-		manifest.WithGoProxyClient(goproxy.NewClient(
-			goproxy.WithRequestFactory(
-				request.NewRequestFactory(reqOps...),
-			),
+		manifest.WithGoProxyClient(client),
+		manifest.WithConcurrency(*concurrency),
+		manifest.WithToolchainResolver(toolchain.NewResolver(
+			toolchain.WithListingSource(*toolchainList),
+			toolchain.WithOffline(*offline),
+			toolchain.WithRetryPolicy(retryPolicy()),
+			toolchain.WithLogger(log.Named("toolchain")),
 		)),
 	)
 
 	if err != nil {
-		log.Panic("Failed to read manifiest", zap.Error(err))
+		log.Error("Failed to read manifiest", zap.Error(err))
+		return 1
 	}
 
-	modifier := resolve.NewModifier(
-		path.Dir(*configDir),
-		m,
+	modOps := []resolve.ModifierOption{
 		resolve.WithLogger(log.Named("modifier")),
-	)
-	if err := modifier.Update(); err != nil {
+		resolve.WithGoProxyClient(client),
+	}
+	if *dryRun {
+		modOps = append(modOps, resolve.WithDryRun(os.Stdout))
+	}
+
+	modifier := resolve.NewModifier(path.Dir(*configDir), m, modOps...)
+
+	if command == commandCheck {
+		drifts, err := modifier.Check(ctx)
+		if err != nil {
+			log.Error("Failed to check go.mod files", zap.Error(err))
+			return 1
+		}
+		for _, d := range drifts {
+			fmt.Fprintln(os.Stdout, d)
+		}
+		if len(drifts) > 0 {
+			log.Error("Go mod files do not match the manifest", zap.Int("drifts", len(drifts)))
+			return 1
+		}
+		log.Info("All go mod files match the manifest")
+		return 0
+	}
+
+	if err := modifier.Update(ctx); err != nil {
 		log.Error("Failed to modifier go.mod files", zap.Error(err))
+		return 1
 	}
 	log.Info("Finished processing mod files")
+	return 0
+}
+
+func retryPolicy() request.RetryPolicy {
+	policy := request.DefaultRetryPolicy()
+	policy.Attempts = *retries + 1
+	policy.Timeout = *requestTimeout
+	return policy
 }
@@ -0,0 +1,263 @@
+// Package constraint parses semantic version constraint
+// expressions such as `^1.4`, `~0.61.0`, `>=1.2.0 <2.0.0` and `1.x`
+// and matches them against module versions.
+package constraint
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+var (
+	ErrInvalidConstraint = errors.New("invalid constraint")
+)
+
+type (
+	// Constraint is a set of alternatives separated by `||`,
+	// a version satisfies the constraint when it matches every
+	// comparator within any one alternative.
+	Constraint struct {
+		expr   string
+		groups [][]comparator
+	}
+
+	comparator struct {
+		min, max                   string
+		minInclusive, maxInclusive bool
+		negate                     bool
+		// prerelease is the core version of a comparator that
+		// explicitly references a prerelease, ie `>=1.2.0-rc.1`.
+		prerelease string
+	}
+
+	// partial is a parsed version that may
+	// be missing trailing numbers or use wildcards.
+	partial struct {
+		nums  []int
+		pre   string
+		parts int
+	}
+)
+
+// Parse reads the constraint expression and returns
+// an error wrapping ErrInvalidConstraint if it can not be understood.
+func Parse(expr string) (*Constraint, error) {
+	c := &Constraint{expr: expr}
+	for _, alt := range strings.Split(expr, "||") {
+		fields := strings.FieldsFunc(alt, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%q has an empty expression: %w", expr, ErrInvalidConstraint)
+		}
+		group := make([]comparator, 0, len(fields))
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// Allow operators to be separated from the version, ie `>= 1.2`.
+			if strings.TrimLeft(field, "<>=!~^") == "" && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+			cmp, err := parseComparator(field)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", expr, err)
+			}
+			group = append(group, cmp)
+		}
+		c.groups = append(c.groups, group)
+	}
+	return c, nil
+}
+
+// Check reports if the version satisfies the constraint.
+// Prerelease versions only match when a comparator within the
+// same alternative references a prerelease of the same core version.
+func (c *Constraint) Check(version string) bool {
+	return c.check(version, false)
+}
+
+// CheckIncludePrerelease reports if the version satisfies the constraint,
+// prerelease versions are compared the same as any other version.
+func (c *Constraint) CheckIncludePrerelease(version string) bool {
+	return c.check(version, true)
+}
+
+func (c *Constraint) check(version string, includePrerelease bool) bool {
+	if !semver.IsValid(version) {
+		return false
+	}
+	core := semver.Canonical(version)
+	if pre := semver.Prerelease(version); pre != "" {
+		core = strings.TrimSuffix(core, pre)
+	}
+	for _, group := range c.groups {
+		matched, allowPre := true, includePrerelease || semver.Prerelease(version) == ""
+		for _, cmp := range group {
+			if !cmp.match(version) {
+				matched = false
+				break
+			}
+			if cmp.prerelease == core {
+				allowPre = true
+			}
+		}
+		if matched && allowPre {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Constraint) String() string {
+	return c.expr
+}
+
+func parseComparator(field string) (comparator, error) {
+	op := field[:len(field)-len(strings.TrimLeft(field, "<>=!~^"))]
+	p, err := parsePartial(strings.TrimPrefix(field, op))
+	if err != nil {
+		return comparator{}, err
+	}
+
+	cmp := comparator{}
+	if p.pre != "" {
+		cmp.prerelease = strings.TrimSuffix(p.lower(), p.pre)
+	}
+
+	switch op {
+	case "", "=", "==", "!=":
+		cmp.negate = op == "!="
+		switch p.parts {
+		case 0:
+		case 3:
+			cmp.min, cmp.max = p.lower(), p.lower()
+			cmp.minInclusive, cmp.maxInclusive = true, true
+		default:
+			cmp.min, cmp.minInclusive, cmp.max = p.lower(), true, p.bump(p.parts-1)
+		}
+	case ">":
+		switch p.parts {
+		case 0:
+			cmp.negate = true
+		case 3:
+			cmp.min = p.lower()
+		default:
+			cmp.min, cmp.minInclusive = p.bump(p.parts-1), true
+		}
+	case ">=":
+		cmp.min, cmp.minInclusive = p.lower(), true
+	case "<":
+		cmp.max = p.lower()
+	case "<=":
+		switch p.parts {
+		case 0:
+		case 3:
+			cmp.max, cmp.maxInclusive = p.lower(), true
+		default:
+			cmp.max = p.bump(p.parts - 1)
+		}
+	case "~", "~>":
+		switch p.parts {
+		case 0:
+		case 1:
+			cmp.min, cmp.minInclusive, cmp.max = p.lower(), true, p.bump(0)
+		default:
+			cmp.min, cmp.minInclusive, cmp.max = p.lower(), true, p.bump(1)
+		}
+	case "^":
+		switch {
+		case p.parts == 0:
+		case p.nums[0] > 0 || p.parts == 1:
+			cmp.min, cmp.minInclusive, cmp.max = p.lower(), true, p.bump(0)
+		case p.nums[1] > 0 || p.parts == 2:
+			cmp.min, cmp.minInclusive, cmp.max = p.lower(), true, p.bump(1)
+		default:
+			cmp.min, cmp.minInclusive, cmp.max = p.lower(), true, p.bump(2)
+		}
+	default:
+		return comparator{}, fmt.Errorf("unknown operator %q: %w", op, ErrInvalidConstraint)
+	}
+	return cmp, nil
+}
+
+// match reports if the version is within the comparator's bounds,
+// an empty bound is treated as unbounded.
+func (c comparator) match(v string) bool {
+	in := true
+	if c.min != "" {
+		n := semver.Compare(v, c.min)
+		in = n > 0 || (n == 0 && c.minInclusive)
+	}
+	if in && c.max != "" {
+		n := semver.Compare(v, c.max)
+		in = n < 0 || (n == 0 && c.maxInclusive)
+	}
+	return in != c.negate
+}
+
+func parsePartial(s string) (partial, error) {
+	s = strings.TrimPrefix(s, "v")
+	p := partial{nums: make([]int, 3)}
+	if s == "" {
+		return p, fmt.Errorf("missing version: %w", ErrInvalidConstraint)
+	}
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, p.pre = s[:i], s[i:]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return p, fmt.Errorf("version %q has too many components: %w", s, ErrInvalidConstraint)
+	}
+	for i, part := range parts {
+		switch part {
+		case "x", "X", "*":
+			if p.pre != "" {
+				return p, fmt.Errorf("wildcard version %q can not have a prerelease: %w", s, ErrInvalidConstraint)
+			}
+			continue
+		}
+		if p.parts != i {
+			return p, fmt.Errorf("version %q has numbers after a wildcard: %w", s, ErrInvalidConstraint)
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return p, fmt.Errorf("version %q has invalid number %q: %w", s, part, ErrInvalidConstraint)
+		}
+		p.nums[i], p.parts = n, i+1
+	}
+	if p.pre != "" && p.parts != 3 {
+		return p, fmt.Errorf("partial version %q can not have a prerelease: %w", s, ErrInvalidConstraint)
+	}
+	if p.pre != "" && !semver.IsValid(p.lower()) {
+		return p, fmt.Errorf("version %q has invalid prerelease %q: %w", s, p.pre, ErrInvalidConstraint)
+	}
+	return p, nil
+}
+
+// lower returns the smallest version matching the partial version.
+func (p partial) lower() string {
+	v := fmt.Sprintf("v%d.%d.%d", p.nums[0], p.nums[1], p.nums[2])
+	if p.pre != "" {
+		return v + p.pre
+	}
+	return v
+}
+
+// bump returns the version with the component at idx incremented
+// and all following components reset to zero, the lowest prerelease
+// is used so any prereleases of the bumped version are excluded.
+func (p partial) bump(idx int) string {
+	nums := append([]int(nil), p.nums...)
+	nums[idx]++
+	for i := idx + 1; i < len(nums); i++ {
+		nums[i] = 0
+	}
+	return fmt.Sprintf("v%d.%d.%d-0", nums[0], nums[1], nums[2])
+}
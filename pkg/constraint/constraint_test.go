@@ -0,0 +1,185 @@
+package constraint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsingConstraint(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		expr string
+		err  error
+	}{
+		{expr: "^1.4", err: nil},
+		{expr: "~0.61.0", err: nil},
+		{expr: ">=1.2.0 <2.0.0", err: nil},
+		{expr: ">= 1.2.0, < 2.0.0", err: nil},
+		{expr: "1.x", err: nil},
+		{expr: "^1.2 || ~0.4.0", err: nil},
+		{expr: ">=v1.2.0-rc.1", err: nil},
+		{expr: "", err: ErrInvalidConstraint},
+		{expr: "^1.2 ||", err: ErrInvalidConstraint},
+		{expr: "latest", err: ErrInvalidConstraint},
+		{expr: "1.x.2", err: ErrInvalidConstraint},
+		{expr: "=>1.2.0", err: ErrInvalidConstraint},
+		{expr: "1.2-rc.1", err: ErrInvalidConstraint},
+		{expr: "1.2.3.4", err: ErrInvalidConstraint},
+		{expr: "01.2.3", err: ErrInvalidConstraint},
+	} {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(tc.expr)
+			assert.ErrorIs(t, err, tc.err, "Must match the expected error")
+		})
+	}
+}
+
+func TestCheckingConstraint(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		expr     string
+		versions map[string]bool
+	}{
+		{
+			expr: "^1.4",
+			versions: map[string]bool{
+				"v1.3.9":      false,
+				"v1.4.0":      true,
+				"v1.9.2":      true,
+				"v2.0.0":      false,
+				"v1.5.0-rc.1": false,
+			},
+		},
+		{
+			expr: "^0.4.1",
+			versions: map[string]bool{
+				"v0.4.0": false,
+				"v0.4.1": true,
+				"v0.4.9": true,
+				"v0.5.0": false,
+			},
+		},
+		{
+			expr: "^0.0.3",
+			versions: map[string]bool{
+				"v0.0.3": true,
+				"v0.0.4": false,
+			},
+		},
+		{
+			expr: "~0.61.0",
+			versions: map[string]bool{
+				"v0.60.9": false,
+				"v0.61.0": true,
+				"v0.61.7": true,
+				"v0.62.0": false,
+			},
+		},
+		{
+			expr: "~1",
+			versions: map[string]bool{
+				"v1.0.0": true,
+				"v1.8.0": true,
+				"v2.0.0": false,
+			},
+		},
+		{
+			expr: ">=1.2.0 <2.0.0",
+			versions: map[string]bool{
+				"v1.1.9":      false,
+				"v1.2.0":      true,
+				"v1.99.0":     true,
+				"v2.0.0-rc.1": false,
+				"v2.0.0":      false,
+			},
+		},
+		{
+			expr: "1.x",
+			versions: map[string]bool{
+				"v0.9.0": false,
+				"v1.0.0": true,
+				"v1.7.3": true,
+				"v2.0.0": false,
+			},
+		},
+		{
+			expr: ">1.2 <=1.4",
+			versions: map[string]bool{
+				"v1.2.9": false,
+				"v1.3.0": true,
+				"v1.4.9": true,
+				"v1.5.0": false,
+			},
+		},
+		{
+			expr: "!=1.2.3 1.2.x",
+			versions: map[string]bool{
+				"v1.2.2": true,
+				"v1.2.3": false,
+				"v1.2.4": true,
+			},
+		},
+		{
+			expr: "^1.2 || ~0.4.0",
+			versions: map[string]bool{
+				"v0.3.0": false,
+				"v0.4.5": true,
+				"v0.5.0": false,
+				"v1.2.0": true,
+			},
+		},
+		{
+			expr: ">=1.2.0-rc.1",
+			versions: map[string]bool{
+				"v1.2.0-rc.0": false,
+				"v1.2.0-rc.1": true,
+				"v1.2.0":      true,
+				"v1.3.0-rc.1": false,
+			},
+		},
+		{
+			expr: "1.2.3",
+			versions: map[string]bool{
+				"v1.2.3":              true,
+				"v1.2.3+incompatible": true,
+				"v1.2.4":              false,
+				"invalid":             false,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := Parse(tc.expr)
+			require.NoError(t, err, "Must be a valid constraint")
+			for v, expect := range tc.versions {
+				assert.Equal(t, expect, c.Check(v), "Must match the expected result for %s", v)
+			}
+		})
+	}
+}
+
+func TestCheckIncludePrerelease(t *testing.T) {
+	t.Parallel()
+
+	c, err := Parse("^1.21")
+	require.NoError(t, err, "Must be a valid constraint")
+
+	for v, expect := range map[string]bool{
+		"v1.24.0-rc.1": true,
+		"v1.21.0-rc.1": false,
+		"v2.0.0-rc.1":  false,
+		"v1.22.0":      true,
+	} {
+		assert.Equal(t, expect, c.CheckIncludePrerelease(v), "Must match the expected result for %s", v)
+	}
+	assert.False(t, c.Check("v1.24.0-rc.1"), "Must still exclude prereleases by default")
+}
@@ -0,0 +1,114 @@
+package goproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+type (
+	// ResponseCache stores successful proxy responses keyed by their request URL,
+	// which includes both the proxy and the module path.
+	ResponseCache interface {
+		Get(key string) (resp *CachedResponse, ok bool)
+		Put(key string, resp *CachedResponse) error
+	}
+
+	// CachedResponse is a proxy response body along
+	// with the headers needed to revalidate it.
+	CachedResponse struct {
+		Body         []byte    `json:"body"`
+		ETag         string    `json:"etag,omitempty"`
+		LastModified string    `json:"last_modified,omitempty"`
+		Stored       time.Time `json:"stored"`
+	}
+
+	diskCache struct {
+		dir string
+	}
+
+	responseCache struct {
+		store ResponseCache
+		ttl   time.Duration
+	}
+)
+
+var (
+	_ ResponseCache = (*diskCache)(nil)
+)
+
+// DefaultCacheDir returns the directory within the
+// user's cache directory used to store proxy responses.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "versionist", "goproxy"), nil
+}
+
+// NewDiskCache stores each response as a file within dir.
+func NewDiskCache(dir string) ResponseCache {
+	return &diskCache{dir: dir}
+}
+
+// WithResponseCache caches proxy responses, a response is reused without
+// any request until the ttl has passed, after which it is revalidated
+// using the `If-None-Match` and `If-Modified-Since` headers.
+func WithResponseCache(store ResponseCache, ttl time.Duration) ClientOptionFunc {
+	return func(proxy *goproxy) {
+		proxy.cache = &responseCache{store: store, ttl: ttl}
+	}
+}
+
+func (dc *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(dc.dir, name[:2], name+".json")
+}
+
+func (dc *diskCache) Get(key string) (*CachedResponse, bool) {
+	content, err := os.ReadFile(dc.path(key))
+	if err != nil {
+		return nil, false
+	}
+	resp := &CachedResponse{}
+	if err := json.Unmarshal(content, resp); err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+func (dc *diskCache) Put(key string, resp *CachedResponse) error {
+	content, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	name := dc.path(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so concurrent
+	// readers never observe a partially written entry.
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		return multierr.Combine(err, f.Close(), os.Remove(f.Name()))
+	}
+	if err := f.Close(); err != nil {
+		return multierr.Append(err, os.Remove(f.Name()))
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// fresh reports if the cached response can be used without revalidation.
+func (rc *responseCache) fresh(resp *CachedResponse) bool {
+	return time.Since(resp.Stored) < rc.ttl
+}
@@ -0,0 +1,82 @@
+package goproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestDiskCache(t *testing.T) {
+	t.Parallel()
+
+	cache := NewDiskCache(t.TempDir())
+
+	_, ok := cache.Get("https://proxy.golang.org/golang.org/x/mod/@v/list")
+	assert.False(t, ok, "Must not have a cached entry")
+
+	stored := &CachedResponse{
+		Body:   []byte("v0.6.0\n"),
+		ETag:   `"abc"`,
+		Stored: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, cache.Put("https://proxy.golang.org/golang.org/x/mod/@v/list", stored), "Must store the response")
+
+	resp, ok := cache.Get("https://proxy.golang.org/golang.org/x/mod/@v/list")
+	assert.True(t, ok, "Must have a cached entry")
+	assert.Equal(t, stored, resp, "Must return the stored response")
+
+	_, ok = cache.Get("https://goproxy.io/golang.org/x/mod/@v/list")
+	assert.False(t, ok, "Must key entries by the full url")
+}
+
+func TestCachedResponses(t *testing.T) {
+	t.Parallel()
+
+	var requests, revalidated atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = io.WriteString(w, "v1.0.0\n")
+	}))
+	t.Cleanup(s.Close)
+
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err, "Must be a valid url")
+
+	newClient := func(ttl time.Duration, cache ResponseCache) Client {
+		return NewClient(
+			WithGoProxyLogger(zaptest.NewLogger(t)),
+			WithGoProxyProxies(ResolverFunc(func(string) []Proxy { return []Proxy{{URL: *u}} })),
+			WithResponseCache(cache, ttl),
+		)
+	}
+
+	ctx, cache := context.Background(), NewDiskCache(t.TempDir())
+
+	for i := 0; i < 3; i++ {
+		versions, err := newClient(time.Hour, cache).List(ctx, "github.com/awesome/package")
+		require.NoError(t, err, "Must not error when listing versions")
+		assert.Equal(t, []string{"v1.0.0"}, versions, "Must return the listed versions")
+	}
+	assert.EqualValues(t, 1, requests.Load(), "Must only request once while the cache is fresh")
+
+	versions, err := newClient(0, cache).List(ctx, "github.com/awesome/package")
+	require.NoError(t, err, "Must not error when listing versions")
+	assert.Equal(t, []string{"v1.0.0"}, versions, "Must return the revalidated versions")
+	assert.EqualValues(t, 2, requests.Load(), "Must request when the cache is stale")
+	assert.EqualValues(t, 1, revalidated.Load(), "Must revalidate the stale entry")
+}
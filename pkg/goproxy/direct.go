@@ -0,0 +1,324 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	"github.com/MovieStoreGuy/versionist/pkg/request"
+)
+
+var (
+	ErrUnknownRepository = errors.New("unknown repository")
+)
+
+type (
+	// RepositoryFunc maps a module path to the URL of its git repository
+	// and the directory of the module within that repository.
+	RepositoryFunc func(module string) (repo, dir string, err error)
+
+	// direct resolves modules using `git` against the module's repository
+	direct struct {
+		log        *zap.Logger
+		repository RepositoryFunc
+		// net, reqfact and retry are used for go-get discovery
+		// of modules unknown to the repository func.
+		net     *http.Client
+		reqfact request.Factory
+		retry   request.RetryPolicy
+
+		mu         sync.Mutex
+		discovered map[string]repository
+	}
+
+	repository struct {
+		repo, dir string
+	}
+)
+
+// WithDirectRepositories overrides how module paths
+// are mapped to repositories when resolving directly.
+func WithDirectRepositories(fn RepositoryFunc) ClientOptionFunc {
+	return func(proxy *goproxy) {
+		proxy.direct.repository = fn
+	}
+}
+
+// HostedRepository maps modules hosted on github.com, gitlab.com and bitbucket.org,
+// or any module path with a `.git` element, to its https repository.
+// Any other module path is left to go-get discovery by the direct client.
+func HostedRepository(path string) (repo, dir string, err error) {
+	prefix, _, _ := module.SplitPathVersion(path)
+	elems := strings.Split(prefix, "/")
+	n := 0
+	switch elems[0] {
+	case "github.com", "gitlab.com", "bitbucket.org":
+		n = 3
+	default:
+		for i, e := range elems {
+			if strings.HasSuffix(e, ".git") {
+				n = i + 1
+				break
+			}
+		}
+	}
+	if n == 0 || len(elems) < n {
+		return "", "", fmt.Errorf("%s: %w", path, ErrUnknownRepository)
+	}
+	return "https://" + strings.Join(elems[:n], "/"), strings.Join(elems[n:], "/"), nil
+}
+
+// RepositoryPrefixes maps module paths within each prefix to the repository of
+// the longest matching prefix, with the rest of the path as the directory.
+// Any other module path is mapped by next.
+func RepositoryPrefixes(prefixes map[string]string, next RepositoryFunc) RepositoryFunc {
+	return func(path string) (repo, dir string, err error) {
+		prefix, _, _ := module.SplitPathVersion(path)
+		match := ""
+		for p := range prefixes {
+			if (path == p || strings.HasPrefix(path, p+"/")) && len(p) > len(match) {
+				match = p
+			}
+		}
+		if match == "" {
+			return next(path)
+		}
+		if strings.HasPrefix(prefix, match+"/") {
+			dir = strings.TrimPrefix(prefix, match+"/")
+		}
+		return prefixes[match], dir, nil
+	}
+}
+
+// fetch answers the GOPROXY protocol request for the module using the
+// tags of its repository, any missing content is reported as not found.
+func (d *direct) fetch(ctx context.Context, path, suffix string) ([]byte, error) {
+	repo, dir, err := d.repository(path)
+	if errors.Is(err, ErrUnknownRepository) {
+		repo, dir, err = d.discover(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tags, err := d.tags(ctx, path, repo, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]string, 0, len(tags))
+	for v := range tags {
+		versions = append(versions, v)
+	}
+	semver.Sort(versions)
+
+	notFound := directNotFound(path, repo)
+	switch {
+	case suffix == "@v/list":
+		return []byte(strings.Join(versions, "\n")), nil
+	case suffix == "@latest":
+		latest := highestVersion(versions)
+		if latest == "" {
+			return nil, notFound
+		}
+		return json.Marshal(Info{Version: latest})
+	}
+
+	escaped := strings.TrimPrefix(suffix, "@v/")
+	ext := escaped[strings.LastIndexByte(escaped, '.'):]
+	version, err := module.UnescapeVersion(strings.TrimSuffix(escaped, ext))
+	if err != nil {
+		return nil, err
+	}
+	tag, ok := tags[version]
+	if !ok {
+		return nil, notFound
+	}
+	switch ext {
+	case ".info":
+		return json.Marshal(Info{Version: version})
+	case ".mod":
+		name := "go.mod"
+		if dir != "" {
+			name = dir + "/go.mod"
+		}
+		return d.show(ctx, path, repo, tag, name)
+	}
+	return nil, fmt.Errorf("%s%s: %w", path, suffix, ErrDirectUnsupported)
+}
+
+// discover resolves the git repository of the module using the go-import
+// meta tag served at https://<module>?go-get=1, the same as the go command.
+func (d *direct) discover(ctx context.Context, path string) (repo, dir string, err error) {
+	d.mu.Lock()
+	found, ok := d.discovered[path]
+	d.mu.Unlock()
+	if ok {
+		return found.repo, found.dir, nil
+	}
+
+	content, err := d.retry.Get(ctx, d.log, d.net, d.reqfact, "https://"+path+"?go-get=1")
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w: %v", path, ErrUnknownRepository, err)
+	}
+
+	prefix, _, _ := module.SplitPathVersion(path)
+	imports, err := parseGoImports(bytes.NewReader(content))
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w: %v", path, ErrUnknownRepository, err)
+	}
+	for _, imp := range imports {
+		if imp.vcs != "git" || (path != imp.prefix && !strings.HasPrefix(path, imp.prefix+"/")) {
+			continue
+		}
+		found = repository{repo: imp.repo}
+		if strings.HasPrefix(prefix, imp.prefix+"/") {
+			found.dir = strings.TrimPrefix(prefix, imp.prefix+"/")
+		}
+		d.log.Debug("Discovered repository", zap.String("module", path), zap.String("repo", found.repo), zap.String("dir", found.dir))
+
+		d.mu.Lock()
+		if d.discovered == nil {
+			d.discovered = make(map[string]repository)
+		}
+		d.discovered[path] = found
+		d.mu.Unlock()
+		return found.repo, found.dir, nil
+	}
+	return "", "", fmt.Errorf("%s: %w: no git go-import meta tag", path, ErrUnknownRepository)
+}
+
+type goImport struct {
+	prefix, vcs, repo string
+}
+
+// parseGoImports returns the go-import meta tags within the head of the html document.
+func parseGoImports(r io.Reader) ([]goImport, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var imports []goImport
+	for {
+		t, err := dec.RawToken()
+		if err != nil {
+			if errors.Is(err, io.EOF) || len(imports) > 0 {
+				return imports, nil
+			}
+			return nil, err
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return imports, nil
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return imports, nil
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") || attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+			imports = append(imports, goImport{prefix: f[0], vcs: f[1], repo: f[2]})
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// tags returns the versions of the module
+// mapped to the tag they are published with.
+func (d *direct) tags(ctx context.Context, path, repo, dir string) (map[string]string, error) {
+	out, err := d.git(ctx, "", "ls-remote", "--tags", repo)
+	if err != nil {
+		return nil, err
+	}
+	_, pathMajor, _ := module.SplitPathVersion(path)
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	tags := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		tag := strings.TrimSuffix(strings.TrimPrefix(fields[1], "refs/tags/"), "^{}")
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		v := strings.TrimPrefix(tag, prefix)
+		if !semver.IsValid(v) || semver.Canonical(v) != v {
+			continue
+		}
+		if module.CheckPathMajor(v, pathMajor) != nil {
+			continue
+		}
+		tags[v] = tag
+	}
+	d.log.Debug("Resolved repository tags", zap.String("module", path), zap.String("repo", repo), zap.Int("tags", len(tags)))
+	return tags, nil
+}
+
+// show reads the file at the tag by fetching only that tag into a temporary repository.
+func (d *direct) show(ctx context.Context, path, repo, tag, name string) ([]byte, error) {
+	tmp, err := os.MkdirTemp("", "versionist-direct-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := d.git(ctx, tmp, "init", "--bare", "--quiet"); err != nil {
+		return nil, err
+	}
+	if _, err := d.git(ctx, tmp, "fetch", "--quiet", "--depth=1", repo, "refs/tags/"+tag); err != nil {
+		return nil, err
+	}
+	content, err := d.git(ctx, tmp, "show", "FETCH_HEAD:"+name)
+	if err != nil {
+		return nil, directNotFound(path, repo)
+	}
+	return content, nil
+}
+
+func directNotFound(path, repo string) error {
+	return &NotFoundError{ProxyStatusError{
+		Module:     path,
+		Proxy:      "direct",
+		URL:        repo,
+		StatusCode: http.StatusNotFound,
+	}}
+}
+
+func (d *direct) git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,243 @@
+package goproxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// newTestRepository creates a bare git repository
+// containing the tagged module files and returns its file url.
+func newTestRepository(t *testing.T, tags map[string]map[string]string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	var (
+		work = t.TempDir()
+		bare = t.TempDir()
+	)
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=versionist", "GIT_AUTHOR_EMAIL=versionist@example.com",
+			"GIT_COMMITTER_NAME=versionist", "GIT_COMMITTER_EMAIL=versionist@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "Must run git %v: %s", args, out)
+	}
+
+	git(bare, "init", "--bare", "--quiet")
+	git(work, "init", "--quiet")
+	for _, tag := range []string{"v1.0.0", "v1.1.0", "v1.2.0-rc.1", "tools/v0.3.0", "tools/v0.4.0", "v2.0.0", "invalid"} {
+		files, ok := tags[tag]
+		if !ok {
+			continue
+		}
+		for name, content := range files {
+			name = filepath.Join(work, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755), "Must create directory")
+			require.NoError(t, os.WriteFile(name, []byte(content), 0o644), "Must write file")
+		}
+		git(work, "add", "-A")
+		git(work, "commit", "--quiet", "--allow-empty", "-m", tag)
+		git(work, "tag", "-a", "-m", tag, tag)
+	}
+	git(work, "push", "--quiet", "--tags", bare)
+
+	return "file://" + filepath.ToSlash(bare)
+}
+
+// discoveryClient returns a http client that sends every request to
+// the handler, allowing go-get discovery of any module path.
+func discoveryClient(t *testing.T, handler http.HandlerFunc) *http.Client {
+	t.Helper()
+
+	s := httptest.NewTLSServer(handler)
+	t.Cleanup(s.Close)
+
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err, "Must parse the server url")
+
+	c := s.Client()
+	base := c.Transport
+	c.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Host = u.Host
+		return base.RoundTrip(req)
+	})
+	return c
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestDirectResolution(t *testing.T) {
+	t.Parallel()
+
+	repo := newTestRepository(t, map[string]map[string]string{
+		"v1.0.0":       {"go.mod": "module example.com/awesome\n\ngo 1.18\n"},
+		"v1.1.0":       {"go.mod": "module example.com/awesome\n\ngo 1.19\n"},
+		"v1.2.0-rc.1":  {},
+		"tools/v0.3.0": {"tools/go.mod": "module example.com/awesome/tools\n\ngo 1.19\n"},
+		"tools/v0.4.0": {},
+		"v2.0.0":       {"go.mod": "module example.com/awesome/v2\n\ngo 1.20\n"},
+		"invalid":      {},
+	})
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(ResolverFunc(func(string) []Proxy {
+			return []Proxy{{Direct: true}}
+		})),
+		WithDirectRepositories(func(path string) (string, string, error) {
+			switch path {
+			case "example.com/awesome", "example.com/awesome/v2":
+				return repo, "", nil
+			case "example.com/awesome/tools":
+				return repo, "tools", nil
+			}
+			return "", "", ErrUnknownRepository
+		}),
+		WithGoProxyHTTPClient(discoveryClient(t, http.NotFound)),
+	)
+
+	ctx := context.Background()
+
+	mappings, err := proxy.GetLatest(ctx, "example.com/awesome", "example.com/awesome/tools", "example.com/awesome/v2")
+	require.NoError(t, err, "Must not error when resolving latest")
+	assert.Equal(t, map[string]string{
+		"example.com/awesome":       "v1.1.0",
+		"example.com/awesome/tools": "v0.4.0",
+		"example.com/awesome/v2":    "v2.0.0",
+	}, mappings, "Must resolve the highest tags")
+
+	versions, err := proxy.List(ctx, "example.com/awesome")
+	require.NoError(t, err, "Must not error when listing versions")
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0", "v1.2.0-rc.1"}, versions, "Must list the tagged versions")
+
+	mod, err := proxy.Mod(ctx, "example.com/awesome/tools", "v0.3.0")
+	require.NoError(t, err, "Must not error when reading go.mod")
+	assert.Equal(t, "example.com/awesome/tools", mod.Module.Mod.Path, "Must read the module's go.mod")
+
+	_, err = proxy.Info(ctx, "example.com/awesome", "v1.9.0")
+	assert.Error(t, err, "Must error for unknown versions")
+
+	_, err = proxy.List(ctx, "example.com/unknown")
+	assert.ErrorIs(t, err, ErrUnknownRepository, "Must error for unknown repositories")
+}
+
+func TestDirectDiscovery(t *testing.T) {
+	t.Parallel()
+
+	repo := newTestRepository(t, map[string]map[string]string{
+		"v1.0.0":       {"go.mod": "module git.example.com/team/service\n\ngo 1.19\n"},
+		"tools/v0.3.0": {"tools/go.mod": "module git.example.com/team/service/tools\n\ngo 1.19\n"},
+	})
+
+	var discoveries int32
+	client := discoveryClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&discoveries, 1)
+		if r.URL.Query().Get("go-get") != "1" || !strings.HasPrefix(r.URL.Path, "/team/service") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `<html><head>
+<meta name="go-import" content="git.example.com/team/service mod https://proxy.example.com">
+<meta name="go-import" content="git.example.com/team/service git %s">
+</head><body>go get git.example.com/team/service</body></html>`, repo)
+	})
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(ResolverFunc(func(string) []Proxy {
+			return []Proxy{{Direct: true}}
+		})),
+		WithGoProxyHTTPClient(client),
+	)
+
+	ctx := context.Background()
+
+	mappings, err := proxy.GetLatest(ctx, "git.example.com/team/service", "git.example.com/team/service/tools")
+	require.NoError(t, err, "Must not error when resolving latest")
+	assert.Equal(t, map[string]string{
+		"git.example.com/team/service":       "v1.0.0",
+		"git.example.com/team/service/tools": "v0.3.0",
+	}, mappings, "Must resolve the tags of the discovered repository")
+
+	mod, err := proxy.Mod(ctx, "git.example.com/team/service/tools", "v0.3.0")
+	require.NoError(t, err, "Must not error when reading go.mod")
+	assert.Equal(t, "git.example.com/team/service/tools", mod.Module.Mod.Path, "Must read the module's go.mod")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&discoveries), "Must discover each module once")
+
+	_, err = proxy.List(ctx, "git.example.com/team/unknown")
+	assert.ErrorIs(t, err, ErrUnknownRepository, "Must error when discovery fails")
+}
+
+func TestHostedRepository(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		module string
+		repo   string
+		dir    string
+		err    error
+	}{
+		{module: "github.com/awesome/package", repo: "https://github.com/awesome/package", dir: ""},
+		{module: "github.com/awesome/package/tools/v2", repo: "https://github.com/awesome/package", dir: "tools"},
+		{module: "gitlab.com/awesome/package/v3", repo: "https://gitlab.com/awesome/package", dir: ""},
+		{module: "git.example.com/team/package.git/tools", repo: "https://git.example.com/team/package.git", dir: "tools"},
+		{module: "go.uber.org/zap", err: ErrUnknownRepository},
+		{module: "github.com/awesome", err: ErrUnknownRepository},
+	} {
+		repo, dir, err := HostedRepository(tc.module)
+		assert.ErrorIs(t, err, tc.err, "Must match the expected error for %s", tc.module)
+		assert.Equal(t, tc.repo, repo, "Must match the expected repository for %s", tc.module)
+		assert.Equal(t, tc.dir, dir, "Must match the expected directory for %s", tc.module)
+	}
+}
+
+func TestRepositoryPrefixes(t *testing.T) {
+	t.Parallel()
+
+	repositories := RepositoryPrefixes(map[string]string{
+		"git.example.com/team":         "ssh://git@git.example.com/team/mono.git",
+		"git.example.com/team/service": "ssh://git@git.example.com/team/service.git",
+	}, HostedRepository)
+
+	for _, tc := range []struct {
+		module string
+		repo   string
+		dir    string
+		err    error
+	}{
+		{module: "git.example.com/team/service", repo: "ssh://git@git.example.com/team/service.git", dir: ""},
+		{module: "git.example.com/team/service/tools/v2", repo: "ssh://git@git.example.com/team/service.git", dir: "tools"},
+		{module: "git.example.com/team/other", repo: "ssh://git@git.example.com/team/mono.git", dir: "other"},
+		{module: "git.example.com/teams", err: ErrUnknownRepository},
+		{module: "github.com/awesome/package", repo: "https://github.com/awesome/package", dir: ""},
+	} {
+		repo, dir, err := repositories(tc.module)
+		assert.ErrorIs(t, err, tc.err, "Must match the expected error for %s", tc.module)
+		assert.Equal(t, tc.repo, repo, "Must match the expected repository for %s", tc.module)
+		assert.Equal(t, tc.dir, dir, "Must match the expected directory for %s", tc.module)
+	}
+}
@@ -0,0 +1,149 @@
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/multierr"
+)
+
+type (
+	// Attempt is the outcome of requesting a module from a single proxy
+	Attempt struct {
+		// Proxy is the proxy URL, or `direct`, that was used
+		Proxy string
+		// StatusCode is the response status, zero when there was no response
+		StatusCode int
+		Err        error
+	}
+
+	// LookupError is returned when no proxy in the chain
+	// was able to respond to the request for the module.
+	LookupError struct {
+		Module   string
+		Suffix   string
+		Attempts []Attempt
+	}
+
+	// ModuleError attributes an error to the module that caused it
+	ModuleError struct {
+		Module string
+		Err    error
+	}
+
+	// ProxyStatusError is returned when a proxy responds
+	// to a request for the module with an unexpected status code.
+	ProxyStatusError struct {
+		Module string
+		// Proxy is the proxy URL, or `direct`, that was used
+		Proxy string
+		// URL is the requested resource
+		URL        string
+		StatusCode int
+		Header     http.Header
+	}
+
+	// NotFoundError is returned when the proxy responds with 404 Not Found.
+	NotFoundError struct {
+		ProxyStatusError
+	}
+
+	// GoneError is returned when the proxy responds with 410 Gone.
+	GoneError struct {
+		ProxyStatusError
+	}
+
+	// UnauthorizedError is returned when the proxy responds with
+	// 401 Unauthorized or 403 Forbidden, meaning credentials are
+	// missing or do not grant access to the module.
+	UnauthorizedError struct {
+		ProxyStatusError
+	}
+)
+
+// newStatusError returns the most specific error for the status code,
+// each of which can be matched as a ProxyStatusError.
+func newStatusError(se ProxyStatusError) error {
+	switch se.StatusCode {
+	case http.StatusNotFound:
+		return &NotFoundError{ProxyStatusError: se}
+	case http.StatusGone:
+		return &GoneError{ProxyStatusError: se}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &UnauthorizedError{ProxyStatusError: se}
+	}
+	return &se
+}
+
+func (se *ProxyStatusError) Error() string {
+	return fmt.Sprintf("%s: %s returned status code %d", se.Module, se.URL, se.StatusCode)
+}
+
+func (nf *NotFoundError) Unwrap() error {
+	return &nf.ProxyStatusError
+}
+
+func (ge *GoneError) Unwrap() error {
+	return &ge.ProxyStatusError
+}
+
+func (ue *UnauthorizedError) Unwrap() error {
+	return &ue.ProxyStatusError
+}
+
+// isNotFound reports if the proxy does not have the requested content,
+// the go command treats both 404 and 410 as not found.
+func isNotFound(err error) bool {
+	var (
+		nf *NotFoundError
+		ge *GoneError
+	)
+	return errors.As(err, &nf) || errors.As(err, &ge)
+}
+
+func (le *LookupError) Error() string {
+	if len(le.Attempts) == 0 {
+		return fmt.Sprintf("%s/%s: no proxies available", le.Module, le.Suffix)
+	}
+	attempts := make([]string, 0, len(le.Attempts))
+	for _, a := range le.Attempts {
+		if a.StatusCode != 0 {
+			attempts = append(attempts, fmt.Sprintf("%s (status %d)", a.Proxy, a.StatusCode))
+			continue
+		}
+		attempts = append(attempts, fmt.Sprintf("%s (%v)", a.Proxy, a.Err))
+	}
+	return fmt.Sprintf("%s/%s: %s", le.Module, le.Suffix, strings.Join(attempts, ", "))
+}
+
+// Unwrap allows the errors of each attempt to be matched.
+func (le *LookupError) Unwrap() error {
+	errs := make([]error, 0, len(le.Attempts))
+	for _, a := range le.Attempts {
+		errs = append(errs, a.Err)
+	}
+	return multierr.Combine(errs...)
+}
+
+func (me *ModuleError) Error() string {
+	return fmt.Sprintf("%s: %v", me.Module, me.Err)
+}
+
+func (me *ModuleError) Unwrap() error {
+	return me.Err
+}
+
+// ModuleErrors maps each ModuleError within
+// the combined errors to the module it belongs to.
+func ModuleErrors(err error) map[string]error {
+	modules := make(map[string]error)
+	for _, err := range multierr.Errors(err) {
+		var me *ModuleError
+		if errors.As(err, &me) {
+			modules[me.Module] = me.Err
+		}
+	}
+	return modules
+}
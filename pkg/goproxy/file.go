@@ -0,0 +1,48 @@
+package goproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// readFile answers the request from a `file://` proxy that is laid out
+// in the GOPROXY format. The `@latest` file is optional, when it is
+// missing the latest version is computed from `@v/list`.
+func readFile(root url.URL, module, suffix string) ([]byte, error) {
+	name := filepath.FromSlash(path.Join(root.Path, caseEncoder(module), suffix))
+	content, err := os.ReadFile(name)
+	switch {
+	case err == nil:
+		return content, nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	case suffix != "@latest":
+		return nil, fileNotFound(root, module, name)
+	}
+
+	versions, err := readFile(root, module, "@v/list")
+	if err != nil {
+		return nil, err
+	}
+	latest := highestVersion(strings.Fields(string(versions)))
+	if latest == "" {
+		return nil, fileNotFound(root, module, name)
+	}
+	return json.Marshal(Info{Version: latest})
+}
+
+func fileNotFound(root url.URL, module, name string) error {
+	return &NotFoundError{ProxyStatusError{
+		Module:     module,
+		Proxy:      root.String(),
+		URL:        "file://" + filepath.ToSlash(name),
+		StatusCode: http.StatusNotFound,
+	}}
+}
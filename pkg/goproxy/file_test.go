@@ -0,0 +1,61 @@
+package goproxy
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFileProxy(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"github.com/!awesome/package/@v/list":        "v1.0.0\nv1.1.0\nv1.2.0-rc.1\n",
+		"github.com/!awesome/package/@v/v1.1.0.info": `{"Version":"v1.1.0"}`,
+		"github.com/!awesome/package/@v/v1.1.0.mod":  "module github.com/Awesome/package\n\ngo 1.19\n",
+		"github.com/awesome/other/@latest":           `{"Version":"v0.2.0"}`,
+		"github.com/awesome/other/@v/v0.2.0.mod":     "module github.com/awesome/other\n",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755), "Must create directory")
+		require.NoError(t, os.WriteFile(name, []byte(content), 0o644), "Must write file")
+	}
+
+	proxies := ParseGoProxies((&url.URL{Scheme: "file", Path: filepath.ToSlash(root)}).String())
+	require.Len(t, proxies, 1, "Must parse the file proxy")
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(ResolverFunc(func(string) []Proxy { return proxies })),
+	)
+
+	ctx := context.Background()
+
+	mappings, err := proxy.GetLatest(ctx, "github.com/Awesome/package", "github.com/awesome/other")
+	require.NoError(t, err, "Must not error when resolving latest")
+	assert.Equal(t, map[string]string{
+		"github.com/Awesome/package": "v1.1.0",
+		"github.com/awesome/other":   "v0.2.0",
+	}, mappings, "Must resolve latest from the list or the latest file")
+
+	versions, err := proxy.List(ctx, "github.com/Awesome/package")
+	require.NoError(t, err, "Must not error when listing versions")
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0", "v1.2.0-rc.1"}, versions, "Must list all versions")
+
+	info, err := proxy.Info(ctx, "github.com/Awesome/package", "v1.1.0")
+	require.NoError(t, err, "Must not error when reading info")
+	assert.Equal(t, "v1.1.0", info.Version, "Must read the version info")
+
+	_, err = proxy.Info(ctx, "github.com/Awesome/package", "v1.0.0")
+	assert.Error(t, err, "Must error when the version info is missing")
+
+	_, err = proxy.List(ctx, "github.com/missing/package")
+	assert.Error(t, err, "Must error when the module is missing")
+}
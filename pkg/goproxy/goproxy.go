@@ -1,38 +1,82 @@
 package goproxy
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
-	"regexp"
 	"strings"
 	"time"
 	"unicode"
 
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
 
+	"github.com/MovieStoreGuy/versionist/pkg/internal/generic"
 	"github.com/MovieStoreGuy/versionist/pkg/request"
 )
 
 type (
+	// Client implements the GOPROXY protocol, each method uses
+	// the first proxy that is able to respond for the module.
 	Client interface {
 		GetLatest(ctx context.Context, projects ...string) (mappings map[string]string, err error)
+		// List returns all known versions of the module, `@v/list`.
+		List(ctx context.Context, module string) (versions []string, err error)
+		// Info returns the metadata of the module's version, `@v/<version>.info`.
+		Info(ctx context.Context, module, version string) (info *Info, err error)
+		// Mod returns the parsed go.mod of the module's version, `@v/<version>.mod`.
+		Mod(ctx context.Context, module, version string) (mod *modfile.File, err error)
+		// Zip returns the source archive of the module's version, `@v/<version>.zip`.
+		Zip(ctx context.Context, module, version string) (archive *zip.Reader, err error)
+		// Retractions returns the retract directives from the
+		// go.mod of the module's latest version.
+		Retractions(ctx context.Context, module string) (retractions Retractions, err error)
 	}
 
 	ClientOptionFunc func(proxy *goproxy)
 
-	// Resolver defines an abstract for loading the go proxy URLs.
+	// Resolver defines an abstract for loading the
+	// ordered go proxy chain used for a module path.
 	Resolver interface {
-		ResolveURLs() []url.URL
+		ResolveProxies(module string) []Proxy
 	}
 
 	// ResolverFunc allows a function to be used
 	// as the GoProxies interface value
-	ResolverFunc func() []url.URL
+	ResolverFunc func(module string) []Proxy
+
+	// ResolverOption configures the resolver
+	// returned by GoProxiesFromEnvironment.
+	ResolverOption func(r *envResolver)
+
+	// Fallback defines when the next proxy in the chain is used
+	Fallback int
+
+	// Proxy is an entry within the GOPROXY chain
+	Proxy struct {
+		URL      url.URL
+		Fallback Fallback
+		// Direct is set for the `direct` keyword, the module is resolved
+		// from its version control repository instead of a proxy.
+		Direct bool
+	}
+
+	envResolver struct {
+		private PrivatePatterns
+		// privateProxies is used for modules matching GONOPROXY
+		// instead of resolving them directly.
+		privateProxies string
+	}
 
 	goproxy struct {
 		net *http.Client
@@ -40,40 +84,123 @@ type (
 
 		reqfact request.Factory
 		proxies Resolver
+		direct  *direct
+		// modcache is set when resolving offline from the module cache
+		modcache string
+		cache    *responseCache
+		// concurrency limits how many modules are resolved at once
+		concurrency int
+		retry       request.RetryPolicy
+	}
+
+	// Retraction is a version interval that the module
+	// author has retracted along with their rationale.
+	Retraction struct {
+		Low, High string
+		Rationale string
 	}
 
-	proxyInfo struct {
-		Version string    `json:"version"`
-		Time    time.Time `json:"time,omitempty"`
+	// Retractions is the set of retracted intervals of a module.
+	Retractions []Retraction
+
+	// Info is the metadata of a module version
+	// returned by the `@latest` and `@v/<version>.info` queries.
+	Info struct {
+		Version string    `json:"Version"`
+		Time    time.Time `json:"Time,omitempty"`
 	}
 )
 
-func GoProxiesFromEnvironment() Resolver {
-	reg := regexp.MustCompile("[,|]")
-	return ResolverFunc(func() (urls []url.URL) {
-		vals, set := os.LookupEnv("GOPROXY")
-		if !set {
-			vals = "https://proxy.golang.org,direct"
-		}
-		for _, v := range reg.Split(vals, -1) {
-			switch v {
-			case "off":
-				return []url.URL{}
-			case "direct":
-				continue
-			default:
-				u, err := url.Parse(v)
-				if err != nil {
-					continue
-				}
-				if !strings.HasPrefix(u.Scheme, "http") || u.Host == "" {
-					continue
-				}
-				urls = append(urls, *u)
+const (
+	// FallbackOnNotFound is used by proxies followed by a comma,
+	// the next proxy is only tried when the response is a 404 or 410.
+	FallbackOnNotFound Fallback = iota
+	// FallbackOnError is used by proxies followed by a pipe,
+	// the next proxy is tried after any error.
+	FallbackOnError
+
+	defaultGoProxy = "https://proxy.golang.org,direct"
+)
+
+var (
+	ErrAllRetracted      = errors.New("all versions retracted")
+	ErrDirectUnsupported = errors.New("direct resolution is not supported")
+)
+
+// WithPrivateProxies routes modules that match GONOPROXY, or GOPRIVATE,
+// to the proxies instead of resolving them directly. The value
+// uses the same format as GOPROXY.
+func WithPrivateProxies(value string) ResolverOption {
+	return func(r *envResolver) {
+		r.privateProxies = value
+	}
+}
+
+// GoProxiesFromEnvironment resolves the proxy chain from GOPROXY,
+// any modules matching the GONOPROXY or GOPRIVATE patterns are never
+// sent to those proxies and are resolved directly instead.
+// The `direct` keyword resolves modules using the tags of their git repository.
+func GoProxiesFromEnvironment(opts ...ResolverOption) Resolver {
+	r := &envResolver{
+		private: PrivatePatternsFromEnvironment(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *envResolver) ResolveProxies(module string) []Proxy {
+	if !r.private.SkipProxy(module) {
+		return ParseGoProxies(os.Getenv("GOPROXY"))
+	}
+	if r.privateProxies != "" {
+		return ParseGoProxies(r.privateProxies)
+	}
+	return []Proxy{{Direct: true}}
+}
+
+// ParseGoProxies reads the GOPROXY value into the ordered proxy chain,
+// an empty value uses the go command's default. The fallback of each
+// proxy is set by the separator that follows it and any entries
+// after `off` are ignored.
+func ParseGoProxies(value string) (proxies []Proxy) {
+	if value == "" {
+		value = defaultGoProxy
+	}
+	for value != "" {
+		entry, fallback := value, FallbackOnNotFound
+		if i := strings.IndexAny(value, ",|"); i >= 0 {
+			if value[i] == '|' {
+				fallback = FallbackOnError
 			}
+			entry, value = value[:i], value[i+1:]
+		} else {
+			value = ""
 		}
-		return urls
-	})
+		entry = strings.TrimSpace(entry)
+		switch entry {
+		case "":
+			continue
+		case "off":
+			return proxies
+		case "direct":
+			proxies = append(proxies, Proxy{Direct: true, Fallback: fallback})
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil {
+			continue
+		}
+		switch {
+		case u.Scheme == "file" && u.Path != "":
+		case strings.HasPrefix(u.Scheme, "http") && u.Host != "":
+		default:
+			continue
+		}
+		proxies = append(proxies, Proxy{URL: *u, Fallback: fallback})
+	}
+	return proxies
 }
 
 func caseEncoder(text string) string {
@@ -114,58 +241,343 @@ func WithGoProxyProxies(proxies Resolver) ClientOptionFunc {
 	}
 }
 
+// WithConcurrency limits the number of modules resolved at
+// once by GetLatest, a limit less than one uses the number of CPUs.
+func WithConcurrency(limit int) ClientOptionFunc {
+	return func(proxy *goproxy) {
+		proxy.concurrency = limit
+	}
+}
+
+// WithRetryPolicy configures how failed proxy requests are retried,
+// every proxy request is an idempotent GET and can be retried.
+func WithRetryPolicy(policy request.RetryPolicy) ClientOptionFunc {
+	return func(proxy *goproxy) {
+		proxy.retry = policy
+	}
+}
+
 func NewClient(opts ...ClientOptionFunc) Client {
 	proxy := &goproxy{
 		net:     http.DefaultClient,
 		log:     zap.NewNop(),
 		reqfact: request.NewRequestFactory(),
 		proxies: GoProxiesFromEnvironment(),
+		direct:  &direct{repository: HostedRepository},
+		retry:   request.DefaultRetryPolicy(),
 	}
 
 	for _, opt := range opts {
 		opt(proxy)
 	}
+	proxy.direct.log = proxy.log.Named("direct")
+	proxy.direct.net = proxy.net
+	proxy.direct.reqfact = proxy.reqfact
+	proxy.direct.retry = proxy.retry
 
 	return proxy
 }
 
-func (gp *goproxy) GetLatest(ctx context.Context, projects ...string) (mappings map[string]string, errs error) {
-	mappings = make(map[string]string, len(projects))
+// GetLatest resolves the latest version of each project concurrently,
+// any errors are combined in project order as a ModuleError.
+func (gp *goproxy) GetLatest(ctx context.Context, projects ...string) (map[string]string, error) {
+	unique := make([]string, 0, len(projects))
+	seen := make(map[string]struct{}, len(projects))
 	for _, project := range projects {
-		for _, u := range gp.proxies.ResolveURLs() {
-			if _, ok := mappings[project]; ok {
-				gp.log.Info("Already resolved project version", zap.String("project", project))
-				continue
-			}
-			u.Path = path.Join(u.Path, caseEncoder(project), "@latest")
-			req, err := gp.reqfact.NewRequest(ctx, http.MethodGet, u.String(), http.NoBody)
-			if err != nil {
-				errs = multierr.Append(errs, err)
-				continue
-			}
-			resp, err := gp.net.Do(req)
-			if err != nil {
-				errs = multierr.Append(errs, err)
-				continue
+		if _, ok := seen[project]; ok {
+			gp.log.Info("Already resolved project version", zap.String("project", project))
+			continue
+		}
+		seen[project] = struct{}{}
+		unique = append(unique, project)
+	}
+
+	versions := make([]string, len(unique))
+	errs := generic.ParallelRangeSlice(unique, gp.concurrency, func(idx int, project string) error {
+		version, err := gp.latest(ctx, project)
+		if err != nil {
+			return &ModuleError{Module: project, Err: err}
+		}
+		versions[idx] = version
+		return nil
+	})
+
+	mappings := make(map[string]string, len(unique))
+	for idx, project := range unique {
+		if versions[idx] != "" {
+			mappings[project] = versions[idx]
+		}
+	}
+	return mappings, errs
+}
+
+// latest resolves the module's latest version, if that version has been
+// retracted then the highest version that is not retracted is used instead.
+func (gp *goproxy) latest(ctx context.Context, module string) (string, error) {
+	var info Info
+	if err := gp.fetchJSON(ctx, module, "@latest", &info); err != nil {
+		return "", err
+	}
+	retractions, err := gp.retractions(ctx, module, info.Version)
+	if err != nil {
+		return "", err
+	}
+	if _, retracted := retractions.Retracted(info.Version); !retracted {
+		return info.Version, nil
+	}
+	gp.log.Info("Latest version is retracted", zap.String("module", module), zap.String("version", info.Version))
+
+	versions, err := gp.List(ctx, module)
+	if err != nil {
+		return "", err
+	}
+	allowed := versions[:0]
+	for _, v := range versions {
+		if _, retracted := retractions.Retracted(v); !retracted {
+			allowed = append(allowed, v)
+		}
+	}
+	if v := highestVersion(allowed); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("%s: %w", module, ErrAllRetracted)
+}
+
+// highestVersion returns the highest release version,
+// or the highest prerelease when there are no releases.
+func highestVersion(versions []string) string {
+	var release, prerelease string
+	for _, v := range versions {
+		switch {
+		case !semver.IsValid(v):
+		case semver.Prerelease(v) != "":
+			if prerelease == "" || semver.Compare(v, prerelease) > 0 {
+				prerelease = v
 			}
-			if resp.StatusCode != http.StatusOK {
-				gp.log.Error("Invalid status code", zap.Int("status-code", resp.StatusCode))
-				errs = multierr.Append(errs, resp.Body.Close())
-				continue
+		case release == "" || semver.Compare(v, release) > 0:
+			release = v
+		}
+	}
+	if release == "" {
+		return prerelease
+	}
+	return release
+}
+
+func (gp *goproxy) Retractions(ctx context.Context, module string) (Retractions, error) {
+	var info Info
+	if err := gp.fetchJSON(ctx, module, "@latest", &info); err != nil {
+		return nil, err
+	}
+	return gp.retractions(ctx, module, info.Version)
+}
+
+func (gp *goproxy) retractions(ctx context.Context, module, version string) (Retractions, error) {
+	mod, err := gp.Mod(ctx, module, version)
+	if err != nil {
+		return nil, err
+	}
+	retractions := make(Retractions, 0, len(mod.Retract))
+	for _, r := range mod.Retract {
+		retractions = append(retractions, Retraction{
+			Low:       r.Low,
+			High:      r.High,
+			Rationale: r.Rationale,
+		})
+	}
+	return retractions, nil
+}
+
+func (gp *goproxy) List(ctx context.Context, module string) ([]string, error) {
+	content, err := gp.fetch(ctx, module, "@v/list")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(content)), nil
+}
+
+func (gp *goproxy) Info(ctx context.Context, module, version string) (*Info, error) {
+	info := &Info{}
+	if err := gp.fetchJSON(ctx, module, "@v/"+caseEncoder(version)+".info", info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (gp *goproxy) Mod(ctx context.Context, module, version string) (*modfile.File, error) {
+	content, err := gp.fetch(ctx, module, "@v/"+caseEncoder(version)+".mod")
+	if err != nil {
+		return nil, err
+	}
+	return modfile.ParseLax(module+"@"+version+"/go.mod", content, nil)
+}
+
+func (gp *goproxy) Zip(ctx context.Context, module, version string) (*zip.Reader, error) {
+	content, err := gp.fetch(ctx, module, "@v/"+caseEncoder(version)+".zip")
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(content), int64(len(content)))
+}
+
+func (gp *goproxy) fetchJSON(ctx context.Context, module, suffix string, v any) error {
+	content, err := gp.fetch(ctx, module, suffix)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("decode %s/%s: %w", module, suffix, err)
+	}
+	return nil
+}
+
+// fetch requests the module's suffix from each proxy in the chain
+// and returns the content from the first to successfully respond.
+// The next proxy is only tried when allowed by the proxy's fallback.
+func (gp *goproxy) fetch(ctx context.Context, module, suffix string) (content []byte, errs error) {
+	lookup := &LookupError{Module: module, Suffix: suffix}
+	var proxies []Proxy
+	switch gp.modcache {
+	case "":
+		proxies = gp.proxies.ResolveProxies(module)
+	default:
+		proxies = gp.modcacheProxies()
+		defer func() {
+			if errs != nil {
+				errs = gp.notCached(module, errs)
 			}
-			var info proxyInfo
-			if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-				errs = multierr.Append(errs, err)
-				errs = multierr.Append(errs, resp.Body.Close())
-				continue
+		}()
+	}
+	for _, p := range proxies {
+		var (
+			content []byte
+			err     error
+			proxy   = p.URL.String()
+		)
+		switch {
+		case p.Direct:
+			proxy = "direct"
+			content, err = gp.direct.fetch(ctx, module, suffix)
+		case p.URL.Scheme == "file":
+			content, err = readFile(p.URL, module, suffix)
+		default:
+			u := p.URL
+			u.Path = path.Join(u.Path, caseEncoder(module), suffix)
+			content, err = gp.get(ctx, module, proxy, u.String())
+		}
+		if err == nil {
+			return content, nil
+		}
+		attempt := Attempt{Proxy: proxy, Err: err}
+		var se *ProxyStatusError
+		if errors.As(err, &se) {
+			attempt.StatusCode = se.StatusCode
+		}
+		lookup.Attempts = append(lookup.Attempts, attempt)
+		if p.Fallback != FallbackOnError && !isNotFound(err) {
+			break
+		}
+	}
+	return nil, lookup
+}
+
+func (gp *goproxy) get(ctx context.Context, module, proxy, u string) ([]byte, error) {
+	var cached *CachedResponse
+	if gp.cache != nil {
+		if c, ok := gp.cache.store.Get(u); ok {
+			if gp.cache.fresh(c) {
+				gp.log.Debug("Using cached response", zap.String("url", u))
+				return c.Body, nil
 			}
-			errs = multierr.Append(errs, resp.Body.Close())
-			mappings[project] = info.Version
+			cached = c
 		}
 	}
-	return mappings, errs
+
+	var content []byte
+	err := gp.retry.Do(ctx, gp.log.With(zap.String("url", u)), func(ctx context.Context) (int, http.Header, error) {
+		var err error
+		content, err = gp.attempt(ctx, module, proxy, u, cached)
+		var se *ProxyStatusError
+		if errors.As(err, &se) {
+			return se.StatusCode, se.Header, err
+		}
+		return 0, nil, err
+	})
+	return content, err
+}
+
+// attempt performs a single request and revalidates
+// the cached response when one is provided.
+func (gp *goproxy) attempt(ctx context.Context, module, proxy, u string, cached *CachedResponse) ([]byte, error) {
+	req, err := gp.reqfact.NewRequest(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := gp.net.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		gp.log.Debug("Revalidated cached response", zap.String("url", u))
+		cached.Stored = time.Now()
+		if err := gp.cache.store.Put(u, cached); err != nil {
+			gp.log.Warn("Failed to cache response", zap.String("url", u), zap.Error(err))
+		}
+		return cached.Body, resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK {
+		gp.log.Debug("Unexpected status code",
+			zap.String("module", module),
+			zap.String("url", u),
+			zap.Int("status-code", resp.StatusCode),
+		)
+		return nil, multierr.Append(
+			newStatusError(ProxyStatusError{
+				Module:     module,
+				Proxy:      proxy,
+				URL:        u,
+				StatusCode: resp.StatusCode,
+				Header:     resp.Header,
+			}),
+			resp.Body.Close(),
+		)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, multierr.Append(err, resp.Body.Close())
+	}
+	if gp.cache != nil {
+		err = gp.cache.store.Put(u, &CachedResponse{
+			Body:         content,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Stored:       time.Now(),
+		})
+		if err != nil {
+			gp.log.Warn("Failed to cache response", zap.String("url", u), zap.Error(err))
+		}
+	}
+	return content, resp.Body.Close()
+}
+
+// Retracted returns the retraction that contains the version.
+func (rs Retractions) Retracted(version string) (Retraction, bool) {
+	for _, r := range rs {
+		if semver.Compare(r.Low, version) <= 0 && semver.Compare(version, r.High) <= 0 {
+			return r, true
+		}
+	}
+	return Retraction{}, false
 }
 
-func (fn ResolverFunc) ResolveURLs() []url.URL {
-	return fn()
+func (fn ResolverFunc) ResolveProxies(module string) []Proxy {
+	return fn(module)
 }
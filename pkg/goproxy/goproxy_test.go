@@ -1,12 +1,26 @@
 package goproxy
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
 	"go.uber.org/zap/zaptest"
+
+	"github.com/MovieStoreGuy/versionist/pkg/request"
 )
 
 func TestDefaultProxy(t *testing.T) {
@@ -25,3 +39,465 @@ func TestDefaultProxy(t *testing.T) {
 	require.NoError(t, err, "Must to error when checking latest sdk")
 	require.Len(t, mappings, 1, "Must have only one entry")
 }
+
+// newTestProxy serves the files using the GOPROXY layout
+// and returns a resolver that only uses the test server.
+func newTestProxy(t *testing.T, files map[string]string) Resolver {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, content)
+	}))
+	t.Cleanup(s.Close)
+
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err, "Must be a valid url")
+	return ResolverFunc(func(string) []Proxy { return []Proxy{{URL: *u}} })
+}
+
+func newTestZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err, "Must create zip entry")
+		_, err = io.WriteString(f, content)
+		require.NoError(t, err, "Must write zip entry")
+	}
+	require.NoError(t, w.Close(), "Must close zip")
+	return buf.String()
+}
+
+func TestClientProtocol(t *testing.T) {
+	t.Parallel()
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(newTestProxy(t, map[string]string{
+			"/github.com/!awesome/package/@latest":              `{"Version":"v1.1.0","Time":"2022-10-01T00:00:00Z"}`,
+			"/github.com/!awesome/package/@v/list":              "v1.0.0\nv1.1.0\nv1.2.0-RC1\n",
+			"/github.com/!awesome/package/@v/v1.2.0-!r!c1.info": `{"Version":"v1.2.0-RC1","Time":"2022-11-01T00:00:00Z"}`,
+			"/github.com/!awesome/package/@v/v1.1.0.mod":        "module github.com/Awesome/package\n\ngo 1.19\n",
+			"/github.com/!awesome/package/@v/v1.1.0.zip": newTestZip(t, map[string]string{
+				"github.com/!awesome/package@v1.1.0/go.mod": "module github.com/Awesome/package\n",
+			}),
+		})),
+	)
+
+	ctx := context.Background()
+
+	mappings, err := proxy.GetLatest(ctx, "github.com/Awesome/package")
+	require.NoError(t, err, "Must not error when resolving latest")
+	assert.Equal(t, map[string]string{"github.com/Awesome/package": "v1.1.0"}, mappings, "Must resolve the latest version")
+
+	versions, err := proxy.List(ctx, "github.com/Awesome/package")
+	require.NoError(t, err, "Must not error when listing versions")
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0", "v1.2.0-RC1"}, versions, "Must return all listed versions")
+
+	info, err := proxy.Info(ctx, "github.com/Awesome/package", "v1.2.0-RC1")
+	require.NoError(t, err, "Must not error when reading info")
+	assert.Equal(t, &Info{Version: "v1.2.0-RC1", Time: time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)}, info, "Must decode the version info")
+
+	mod, err := proxy.Mod(ctx, "github.com/Awesome/package", "v1.1.0")
+	require.NoError(t, err, "Must not error when reading go.mod")
+	assert.Equal(t, "github.com/Awesome/package", mod.Module.Mod.Path, "Must parse the module path")
+	assert.Equal(t, "1.19", mod.Go.Version, "Must parse the go version")
+
+	archive, err := proxy.Zip(ctx, "github.com/Awesome/package", "v1.1.0")
+	require.NoError(t, err, "Must not error when reading zip")
+	require.Len(t, archive.File, 1, "Must contain the archived files")
+	assert.Equal(t, "github.com/!awesome/package@v1.1.0/go.mod", archive.File[0].Name, "Must match the archived file")
+
+	_, err = proxy.List(ctx, "github.com/missing/package")
+	assert.Error(t, err, "Must error when no proxy can list versions")
+}
+
+func TestLatestRetracted(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		scenario string
+		files    map[string]string
+		version  string
+		err      error
+	}{
+		{
+			scenario: "latest is not retracted",
+			files: map[string]string{
+				"/github.com/awesome/package/@latest":       `{"Version":"v1.1.0"}`,
+				"/github.com/awesome/package/@v/v1.1.0.mod": "module github.com/awesome/package\n\nretract v1.0.1 // Published by accident\n",
+			},
+			version: "v1.1.0",
+		},
+		{
+			scenario: "latest is retracted",
+			files: map[string]string{
+				"/github.com/awesome/package/@latest":       `{"Version":"v1.2.0"}`,
+				"/github.com/awesome/package/@v/list":       "v1.0.0\nv1.1.0\nv1.1.1\nv1.2.0\nv1.3.0-rc.1\n",
+				"/github.com/awesome/package/@v/v1.2.0.mod": "module github.com/awesome/package\n\nretract (\n\tv1.2.0 // Breaks the API\n\t[v1.1.1, v1.1.9]\n)\n",
+			},
+			version: "v1.1.0",
+		},
+		{
+			scenario: "all versions retracted",
+			files: map[string]string{
+				"/github.com/awesome/package/@latest":       `{"Version":"v1.0.1"}`,
+				"/github.com/awesome/package/@v/list":       "v1.0.0\nv1.0.1\n",
+				"/github.com/awesome/package/@v/v1.0.1.mod": "module github.com/awesome/package\n\nretract [v1.0.0, v1.0.1]\n",
+			},
+			err: ErrAllRetracted,
+		},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			proxy := NewClient(
+				WithGoProxyLogger(zaptest.NewLogger(t)),
+				WithGoProxyProxies(newTestProxy(t, tc.files)),
+			)
+
+			mappings, err := proxy.GetLatest(context.Background(), "github.com/awesome/package")
+			assert.ErrorIs(t, err, tc.err, "Must match the expected error")
+			if tc.err != nil {
+				return
+			}
+			assert.Equal(t, tc.version, mappings["github.com/awesome/package"], "Must resolve the expected version")
+		})
+	}
+}
+
+func TestRetractions(t *testing.T) {
+	t.Parallel()
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(newTestProxy(t, map[string]string{
+			"/github.com/awesome/package/@latest":       `{"Version":"v1.2.0"}`,
+			"/github.com/awesome/package/@v/v1.2.0.mod": "module github.com/awesome/package\n\n// Breaks the API\nretract v1.1.0\n",
+		})),
+	)
+
+	retractions, err := proxy.Retractions(context.Background(), "github.com/awesome/package")
+	require.NoError(t, err, "Must not error when reading retractions")
+
+	r, retracted := retractions.Retracted("v1.1.0")
+	assert.True(t, retracted, "Must report the version as retracted")
+	assert.Equal(t, "Breaks the API", r.Rationale, "Must include the rationale")
+
+	_, retracted = retractions.Retracted("v1.2.0")
+	assert.False(t, retracted, "Must not report the version as retracted")
+}
+
+func TestParseGoProxies(t *testing.T) {
+	t.Parallel()
+
+	mustURL := func(s string) url.URL {
+		u, err := url.Parse(s)
+		require.NoError(t, err, "Must be a valid url")
+		return *u
+	}
+
+	for _, tc := range []struct {
+		value   string
+		proxies []Proxy
+	}{
+		{
+			value: "",
+			proxies: []Proxy{
+				{URL: mustURL("https://proxy.golang.org"), Fallback: FallbackOnNotFound},
+				{Direct: true, Fallback: FallbackOnNotFound},
+			},
+		},
+		{
+			value: "https://athens.internal|https://proxy.golang.org,direct",
+			proxies: []Proxy{
+				{URL: mustURL("https://athens.internal"), Fallback: FallbackOnError},
+				{URL: mustURL("https://proxy.golang.org"), Fallback: FallbackOnNotFound},
+				{Direct: true, Fallback: FallbackOnNotFound},
+			},
+		},
+		{
+			value: "https://athens.internal,https://proxy.golang.org|https://goproxy.io",
+			proxies: []Proxy{
+				{URL: mustURL("https://athens.internal"), Fallback: FallbackOnNotFound},
+				{URL: mustURL("https://proxy.golang.org"), Fallback: FallbackOnError},
+				{URL: mustURL("https://goproxy.io"), Fallback: FallbackOnNotFound},
+			},
+		},
+		{
+			value: "https://athens.internal,off,https://proxy.golang.org",
+			proxies: []Proxy{
+				{URL: mustURL("https://athens.internal"), Fallback: FallbackOnNotFound},
+			},
+		},
+		{
+			value: "file:///srv/goproxy,https://proxy.golang.org",
+			proxies: []Proxy{
+				{URL: mustURL("file:///srv/goproxy"), Fallback: FallbackOnNotFound},
+				{URL: mustURL("https://proxy.golang.org"), Fallback: FallbackOnNotFound},
+			},
+		},
+		{
+			value:   "off",
+			proxies: nil,
+		},
+	} {
+		tc := tc
+		t.Run(tc.value, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.proxies, ParseGoProxies(tc.value), "Must match the expected proxy chain")
+		})
+	}
+}
+
+func TestProxyFallback(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		scenario string
+		status   int
+		fallback Fallback
+		resolved bool
+	}{
+		{scenario: "comma falls through on not found", status: http.StatusNotFound, fallback: FallbackOnNotFound, resolved: true},
+		{scenario: "comma falls through on gone", status: http.StatusGone, fallback: FallbackOnNotFound, resolved: true},
+		{scenario: "comma stops on server error", status: http.StatusInternalServerError, fallback: FallbackOnNotFound, resolved: false},
+		{scenario: "comma stops on unauthorized", status: http.StatusUnauthorized, fallback: FallbackOnNotFound, resolved: false},
+		{scenario: "pipe falls through on server error", status: http.StatusInternalServerError, fallback: FallbackOnError, resolved: true},
+		{scenario: "pipe falls through on not found", status: http.StatusNotFound, fallback: FallbackOnError, resolved: true},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			t.Cleanup(failing.Close)
+
+			u, err := url.Parse(failing.URL)
+			require.NoError(t, err, "Must be a valid url")
+
+			working := newTestProxy(t, map[string]string{
+				"/github.com/awesome/package/@v/list": "v1.0.0\n",
+			}).ResolveProxies("github.com/awesome/package")
+
+			proxy := NewClient(
+				WithGoProxyLogger(zaptest.NewLogger(t)),
+				WithGoProxyProxies(ResolverFunc(func(string) []Proxy {
+					return append([]Proxy{{URL: *u, Fallback: tc.fallback}}, working...)
+				})),
+			)
+
+			versions, err := proxy.List(context.Background(), "github.com/awesome/package")
+			if !tc.resolved {
+				var lookup *LookupError
+				require.ErrorAs(t, err, &lookup, "Must error without trying the next proxy")
+				require.Len(t, lookup.Attempts, 1, "Must only attempt the failing proxy")
+				assert.Equal(t, failing.URL, lookup.Attempts[0].Proxy, "Must report the proxy attempted")
+				assert.Equal(t, tc.status, lookup.Attempts[0].StatusCode, "Must report the proxy's status code")
+				return
+			}
+			assert.NoError(t, err, "Must fall through to the next proxy")
+			assert.Equal(t, []string{"v1.0.0"}, versions, "Must use the next proxy's response")
+		})
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		scenario string
+		status   int
+		target   func(err error) bool
+	}{
+		{scenario: "not found", status: http.StatusNotFound, target: func(err error) bool {
+			var nf *NotFoundError
+			return errors.As(err, &nf)
+		}},
+		{scenario: "gone", status: http.StatusGone, target: func(err error) bool {
+			var ge *GoneError
+			return errors.As(err, &ge)
+		}},
+		{scenario: "unauthorized", status: http.StatusUnauthorized, target: func(err error) bool {
+			var ue *UnauthorizedError
+			return errors.As(err, &ue)
+		}},
+		{scenario: "forbidden", status: http.StatusForbidden, target: func(err error) bool {
+			var ue *UnauthorizedError
+			return errors.As(err, &ue)
+		}},
+		{scenario: "bad request", status: http.StatusBadRequest, target: func(err error) bool {
+			var (
+				nf *NotFoundError
+				ge *GoneError
+				ue *UnauthorizedError
+			)
+			return !errors.As(err, &nf) && !errors.As(err, &ge) && !errors.As(err, &ue)
+		}},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			t.Cleanup(s.Close)
+
+			u, err := url.Parse(s.URL)
+			require.NoError(t, err, "Must be a valid url")
+
+			proxy := NewClient(
+				WithGoProxyLogger(zaptest.NewLogger(t)),
+				WithGoProxyProxies(ResolverFunc(func(string) []Proxy {
+					return []Proxy{{URL: *u}}
+				})),
+			)
+
+			_, err = proxy.List(context.Background(), "github.com/awesome/package")
+			assert.True(t, tc.target(err), "Must match the status specific error")
+
+			var se *ProxyStatusError
+			require.ErrorAs(t, err, &se, "Must match the proxy status error")
+			assert.Equal(t, "github.com/awesome/package", se.Module, "Must reference the module")
+			assert.Equal(t, s.URL, se.Proxy, "Must reference the proxy")
+			assert.Equal(t, s.URL+"/github.com/awesome/package/@v/list", se.URL, "Must reference the requested url")
+			assert.Equal(t, tc.status, se.StatusCode, "Must reference the status code")
+		})
+	}
+}
+
+func TestConcurrentGetLatest(t *testing.T) {
+	t.Parallel()
+
+	files := make(map[string]string)
+	projects := make([]string, 0, 20)
+	expect := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		project := fmt.Sprintf("github.com/awesome/package%d", i)
+		projects = append(projects, project)
+		if i%5 == 0 {
+			continue
+		}
+		version := fmt.Sprintf("v1.%d.0", i)
+		files["/"+project+"/@latest"] = `{"Version":"` + version + `"}`
+		files["/"+project+"/@v/"+version+".mod"] = "module " + project + "\n"
+		expect[project] = version
+	}
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(newTestProxy(t, files)),
+		WithConcurrency(3),
+	)
+
+	mappings, err := proxy.GetLatest(context.Background(), append(projects, projects[1])...)
+	assert.Equal(t, expect, mappings, "Must resolve every available project")
+
+	errs := multierr.Errors(err)
+	require.Len(t, errs, 4, "Must report each unresolved project")
+	for i, err := range errs {
+		var me *ModuleError
+		require.ErrorAs(t, err, &me, "Must be a module error")
+		assert.Equal(t, fmt.Sprintf("github.com/awesome/package%d", i*5), me.Module, "Must attribute the error to the project")
+	}
+	assert.Len(t, ModuleErrors(err), 4, "Must map each error to its project")
+}
+
+func TestRetryingRequests(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		scenario string
+		failures []int
+		header   http.Header
+		attempts int32
+		resolved bool
+	}{
+		{scenario: "no failures", failures: nil, attempts: 1, resolved: true},
+		{scenario: "transient bad gateway", failures: []int{http.StatusBadGateway, http.StatusBadGateway}, attempts: 3, resolved: true},
+		{scenario: "rate limited", failures: []int{http.StatusTooManyRequests}, header: http.Header{"Retry-After": {"0"}}, attempts: 2, resolved: true},
+		{scenario: "too many failures", failures: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}, attempts: 3, resolved: false},
+		{scenario: "not found is not retried", failures: []int{http.StatusNotFound}, attempts: 1, resolved: false},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			var attempts atomic.Int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1))
+				if n <= len(tc.failures) {
+					for k, v := range tc.header {
+						w.Header()[k] = v
+					}
+					w.WriteHeader(tc.failures[n-1])
+					return
+				}
+				_, _ = io.WriteString(w, "v1.0.0\n")
+			}))
+			t.Cleanup(s.Close)
+
+			u, err := url.Parse(s.URL)
+			require.NoError(t, err, "Must be a valid url")
+
+			proxy := NewClient(
+				WithGoProxyLogger(zaptest.NewLogger(t)),
+				WithGoProxyProxies(ResolverFunc(func(string) []Proxy { return []Proxy{{URL: *u}} })),
+				WithRetryPolicy(request.RetryPolicy{
+					Attempts:  3,
+					BaseDelay: time.Millisecond,
+					MaxDelay:  10 * time.Millisecond,
+					Timeout:   time.Second,
+				}),
+			)
+
+			_, err = proxy.List(context.Background(), "github.com/awesome/package")
+			assert.Equal(t, tc.resolved, err == nil, "Must match the expected result: %v", err)
+			assert.Equal(t, tc.attempts, attempts.Load(), "Must match the expected attempts")
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Parallel()
+
+	var attempts atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = io.WriteString(w, "v1.0.0\n")
+	}))
+	t.Cleanup(s.Close)
+
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err, "Must be a valid url")
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(ResolverFunc(func(string) []Proxy { return []Proxy{{URL: *u}} })),
+		WithRetryPolicy(request.RetryPolicy{
+			Attempts:  2,
+			BaseDelay: time.Millisecond,
+			Timeout:   50 * time.Millisecond,
+		}),
+	)
+
+	versions, err := proxy.List(context.Background(), "github.com/awesome/package")
+	require.NoError(t, err, "Must retry after the attempt times out")
+	assert.Equal(t, []string{"v1.0.0"}, versions, "Must return the retried response")
+	assert.EqualValues(t, 2, attempts.Load(), "Must attempt twice")
+}
@@ -0,0 +1,51 @@
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrNotCached = errors.New("not found in module cache")
+)
+
+// ModCacheFromEnvironment returns the module cache directory the
+// go command uses, GOMODCACHE or the first GOPATH entry's `pkg/mod`.
+func ModCacheFromEnvironment() (string, error) {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir, nil
+	}
+	if paths := filepath.SplitList(os.Getenv("GOPATH")); len(paths) > 0 && paths[0] != "" {
+		return filepath.Join(paths[0], "pkg", "mod"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "go", "pkg", "mod"), nil
+}
+
+// WithOfflineModCache stops the client from using the network and
+// resolves every module from the module cache's download directory,
+// which is laid out in the GOPROXY format.
+func WithOfflineModCache(dir string) ClientOptionFunc {
+	return func(proxy *goproxy) {
+		proxy.modcache = dir
+	}
+}
+
+func (gp *goproxy) modcacheProxies() []Proxy {
+	return []Proxy{{
+		URL: url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(gp.modcache, "cache", "download"))},
+	}}
+}
+
+func (gp *goproxy) notCached(module string, err error) error {
+	if !isNotFound(err) {
+		return err
+	}
+	return fmt.Errorf("%s %w %s: %v", module, ErrNotCached, gp.modcache, err)
+}
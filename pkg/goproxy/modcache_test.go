@@ -0,0 +1,65 @@
+package goproxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestModCacheFromEnvironment(t *testing.T) {
+	t.Setenv("GOMODCACHE", "/cache/mod")
+	t.Setenv("GOPATH", "/gopath")
+
+	dir, err := ModCacheFromEnvironment()
+	require.NoError(t, err, "Must resolve the module cache")
+	assert.Equal(t, "/cache/mod", dir, "Must prefer GOMODCACHE")
+
+	t.Setenv("GOMODCACHE", "")
+	t.Setenv("GOPATH", "/gopath"+string(filepath.ListSeparator)+"/other")
+
+	dir, err = ModCacheFromEnvironment()
+	require.NoError(t, err, "Must resolve the module cache")
+	assert.Equal(t, filepath.Join("/gopath", "pkg", "mod"), dir, "Must use the first GOPATH entry")
+}
+
+func TestOfflineModCache(t *testing.T) {
+	t.Parallel()
+
+	modcache := t.TempDir()
+	for name, content := range map[string]string{
+		"cache/download/github.com/awesome/package/@v/list":        "v1.0.0\nv1.1.0\n",
+		"cache/download/github.com/awesome/package/@v/v1.1.0.info": `{"Version":"v1.1.0"}`,
+		"cache/download/github.com/awesome/package/@v/v1.1.0.mod":  "module github.com/awesome/package\n",
+	} {
+		name = filepath.Join(modcache, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755), "Must create directory")
+		require.NoError(t, os.WriteFile(name, []byte(content), 0o644), "Must write file")
+	}
+
+	proxy := NewClient(
+		WithGoProxyLogger(zaptest.NewLogger(t)),
+		WithGoProxyProxies(ResolverFunc(func(string) []Proxy {
+			require.Fail(t, "Must not use the configured proxies when offline")
+			return nil
+		})),
+		WithOfflineModCache(modcache),
+	)
+
+	ctx := context.Background()
+
+	mappings, err := proxy.GetLatest(ctx, "github.com/awesome/package")
+	require.NoError(t, err, "Must not error when resolving latest")
+	assert.Equal(t, map[string]string{"github.com/awesome/package": "v1.1.0"}, mappings, "Must resolve latest from the cached versions")
+
+	versions, err := proxy.List(ctx, "github.com/awesome/package")
+	require.NoError(t, err, "Must not error when listing versions")
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions, "Must list the cached versions")
+
+	_, err = proxy.GetLatest(ctx, "github.com/missing/package")
+	assert.ErrorIs(t, err, ErrNotCached, "Must error when the module is not cached")
+}
@@ -0,0 +1,35 @@
+package goproxy
+
+import (
+	"os"
+
+	"golang.org/x/mod/module"
+)
+
+// PrivatePatterns holds the comma separated glob patterns of module
+// path prefixes that the go command treats as private. Versions are
+// never verified against the checksum database so GONOSUMDB is not used.
+type PrivatePatterns struct {
+	// Private is the GOPRIVATE value, used as the default of NoProxy.
+	Private string
+	// NoProxy is the GONOPROXY value, matching modules are not fetched from a proxy.
+	NoProxy string
+}
+
+// PrivatePatternsFromEnvironment reads the patterns from the environment,
+// GONOPROXY defaults to GOPRIVATE when it is not set.
+func PrivatePatternsFromEnvironment() PrivatePatterns {
+	pp := PrivatePatterns{
+		Private: os.Getenv("GOPRIVATE"),
+		NoProxy: os.Getenv("GONOPROXY"),
+	}
+	if pp.NoProxy == "" {
+		pp.NoProxy = pp.Private
+	}
+	return pp
+}
+
+// SkipProxy reports if the module must not be fetched from a proxy.
+func (pp PrivatePatterns) SkipProxy(path string) bool {
+	return module.MatchPrefixPatterns(pp.NoProxy, path)
+}
@@ -0,0 +1,52 @@
+package goproxy
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivatePatterns(t *testing.T) {
+	t.Setenv("GOPRIVATE", "*.corp.example.com,github.com/awesome/*")
+	t.Setenv("GONOPROXY", "")
+
+	pp := PrivatePatternsFromEnvironment()
+
+	for _, tc := range []struct {
+		module    string
+		skipProxy bool
+	}{
+		{module: "git.corp.example.com/team/service", skipProxy: true},
+		{module: "github.com/awesome/package/v2", skipProxy: true},
+		{module: "github.com/awesome", skipProxy: false},
+		{module: "golang.org/x/mod", skipProxy: false},
+	} {
+		assert.Equal(t, tc.skipProxy, pp.SkipProxy(tc.module), "Must match GONOPROXY for %s", tc.module)
+	}
+
+	t.Setenv("GONOPROXY", "github.com/public/mirror")
+	pp = PrivatePatternsFromEnvironment()
+	assert.True(t, pp.SkipProxy("github.com/public/mirror/tools"), "Must prefer GONOPROXY over GOPRIVATE")
+	assert.False(t, pp.SkipProxy("github.com/awesome/package"), "Must prefer GONOPROXY over GOPRIVATE")
+}
+
+func TestPrivateResolver(t *testing.T) {
+	t.Setenv("GOPROXY", "https://proxy.golang.org,direct")
+	t.Setenv("GOPRIVATE", "github.com/awesome")
+	t.Setenv("GONOPROXY", "")
+
+	public, err := url.Parse("https://proxy.golang.org")
+	require.NoError(t, err, "Must be a valid url")
+	private, err := url.Parse("https://athens.internal")
+	require.NoError(t, err, "Must be a valid url")
+
+	r := GoProxiesFromEnvironment()
+	assert.Equal(t, []Proxy{{URL: *public}, {Direct: true}}, r.ResolveProxies("golang.org/x/mod"), "Must use GOPROXY for public modules")
+	assert.Equal(t, []Proxy{{Direct: true}}, r.ResolveProxies("github.com/awesome/package"), "Must resolve private modules directly")
+
+	r = GoProxiesFromEnvironment(WithPrivateProxies("https://athens.internal"))
+	assert.Equal(t, []Proxy{{URL: *public}, {Direct: true}}, r.ResolveProxies("golang.org/x/mod"), "Must use GOPROXY for public modules")
+	assert.Equal(t, []Proxy{{URL: *private}}, r.ResolveProxies("github.com/awesome/package"), "Must use the private proxies for private modules")
+}
@@ -3,6 +3,9 @@ package filewalk
 import (
 	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"go.uber.org/multierr"
 
@@ -11,43 +14,94 @@ import (
 
 // WalkedFS is used when walking
 // a file system and only capturing a subset.
-type WalkedFS map[string]struct{}
+type WalkedFS struct {
+	root  string
+	files map[string]struct{}
+}
 
 var (
 	_ fs.FS = (*WalkedFS)(nil)
 )
 
-func NewWalkedFS(root string, glob string) (WalkedFS, error) {
-	matched, err := fs.Glob(os.DirFS(root), glob)
+// NewWalkedFS recursively walks root and captures every file called filename.
+// Directories are skipped the same way the go command does when matching
+// packages (vendor, testdata, and nested directories starting with '.' or '_'),
+// along with any slash separated path relative to root that matches one of
+// the ignore patterns.
+func NewWalkedFS(root string, filename string, ignore ...string) (*WalkedFS, error) {
+	for _, pattern := range ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+	wfs := &WalkedFS{root: root, files: make(map[string]struct{})}
+	err := fs.WalkDir(os.DirFS(root), ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if skipDir(d.Name()) || ignored(name, ignore) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == filename && !ignored(name, ignore) {
+			wfs.files[name] = struct{}{}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	wfs := make(WalkedFS)
-	for _, m := range matched {
-		wfs[m] = struct{}{}
-	}
 	return wfs, nil
 }
 
-func (wfs WalkedFS) Open(name string) (fs.File, error) {
-	if _, matched := wfs[name]; !fs.ValidPath(name) || !matched {
-		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+func skipDir(name string) bool {
+	switch name {
+	case "vendor", "testdata":
+		return true
 	}
-	return os.Open(name)
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
 }
 
-func (wfs WalkedFS) Range(fn func(name string, f *os.File) error) error {
-	return generic.ParallelRangeMap(wfs, func(name string, _ struct{}) error {
-		stat, err := os.Stat(name)
-		if err != nil {
-			return err
+func ignored(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
 		}
-		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	}
+	return false
+}
+
+// Names returns the walked file names relative to the root
+func (wfs *WalkedFS) Names() []string {
+	names := make([]string, 0, len(wfs.files))
+	for name := range wfs.files {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (wfs *WalkedFS) Open(name string) (fs.File, error) {
+	if _, matched := wfs.files[name]; !fs.ValidPath(name) || !matched {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Open(filepath.Join(wfs.root, filepath.FromSlash(name)))
+}
+
+// Range opens each walked file as read only and calls fn in parallel,
+// the name provided is the file's path including the root.
+func (wfs *WalkedFS) Range(fn func(name string, f fs.File) error) error {
+	return generic.ParallelRangeMap(wfs.files, func(name string, _ struct{}) error {
+		f, err := wfs.Open(name)
 		if err != nil {
 			return err
 		}
 		return multierr.Combine(
-			fn(name, f),
+			fn(filepath.Join(wfs.root, filepath.FromSlash(name)), f),
 			f.Close(),
 		)
 	})
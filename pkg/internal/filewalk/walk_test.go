@@ -1 +1,93 @@
 package filewalk
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWalkedFS(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{
+		"go.mod",
+		"components/foo/go.mod",
+		"components/foo/bar/go.mod",
+		"components/foo/README.md",
+		"examples/demo/go.mod",
+		"vendor/github.com/awesome/package/go.mod",
+		"internal/testdata/go.mod",
+		".github/go.mod",
+		"tools/_scratch/go.mod",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755), "Must create directory")
+		require.NoError(t, os.WriteFile(name, []byte(name), 0o644), "Must create file")
+	}
+
+	for _, tc := range []struct {
+		scenario string
+		ignore   []string
+		expect   []string
+		err      error
+	}{
+		{
+			scenario: "All nested modules",
+			expect: []string{
+				"go.mod",
+				"components/foo/go.mod",
+				"components/foo/bar/go.mod",
+				"examples/demo/go.mod",
+			},
+		},
+		{
+			scenario: "Ignoring directories",
+			ignore:   []string{"examples/*", "components/foo/bar"},
+			expect: []string{
+				"go.mod",
+				"components/foo/go.mod",
+			},
+		},
+		{
+			scenario: "Invalid ignore pattern",
+			ignore:   []string{"[invalid"},
+			err:      path.ErrBadPattern,
+		},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			wfs, err := NewWalkedFS(root, "go.mod", tc.ignore...)
+			require.ErrorIs(t, err, tc.err, "Must match the expected error")
+			if tc.err != nil {
+				return
+			}
+			assert.ElementsMatch(t, tc.expect, wfs.Names(), "Must match the expected files")
+
+			var (
+				mu   sync.Mutex
+				seen = make(map[string]string)
+			)
+			assert.NoError(t, wfs.Range(func(name string, f fs.File) error {
+				content, err := io.ReadAll(f)
+				mu.Lock()
+				seen[name] = string(content)
+				mu.Unlock()
+				return err
+			}), "Must not error when reading files")
+			for name, content := range seen {
+				assert.Equal(t, name, content, "Must read the walked file")
+			}
+			assert.Len(t, seen, len(tc.expect), "Must read each walked file")
+		})
+	}
+}
@@ -29,3 +29,30 @@ func ParallelRangeMap[K comparable, V any](m map[K]V, fn func(k K, v V) error) e
 	wg.Wait()
 	return multierr.Combine(errs...)
 }
+
+// ParallelRangeSlice calls fn for each item with at most limit running at once,
+// a limit less than one uses the number of CPUs. The returned errors are
+// combined in the same order as the items.
+func ParallelRangeSlice[T any](items []T, limit int, fn func(idx int, item T) error) error {
+	if limit < 1 {
+		limit = runtime.NumCPU()
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(items))
+		sem  = make(chan struct{}, limit)
+	)
+
+	for idx, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(idx int, item T) {
+			errs[idx] = fn(idx, item)
+			wg.Done()
+			<-sem
+		}(idx, item)
+	}
+
+	wg.Wait()
+	return multierr.Combine(errs...)
+}
@@ -1,9 +1,12 @@
 package generic
 
 import (
+	"errors"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
 )
 
 func TestConcurrent(t *testing.T) {
@@ -31,3 +34,32 @@ func TestConcurrent(t *testing.T) {
 		})
 	}
 }
+
+func TestParallelRangeSlice(t *testing.T) {
+	t.Parallel()
+
+	var (
+		running, peak atomic.Int32
+		items         = []string{"foo", "bar", "baz", "qux", "quux"}
+		results       = make([]string, len(items))
+	)
+	err := ParallelRangeSlice(items, 2, func(idx int, item string) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		results[idx] = item
+		if item == "bar" || item == "qux" {
+			return errors.New(item)
+		}
+		return nil
+	})
+
+	assert.Equal(t, items, results, "Must process every item")
+	assert.LessOrEqual(t, peak.Load(), int32(2), "Must not exceed the limit")
+	assert.Equal(t, []error{errors.New("bar"), errors.New("qux")}, multierr.Errors(err), "Must return errors in item order")
+}
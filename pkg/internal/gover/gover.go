@@ -0,0 +1,150 @@
+// Package gover compares Go toolchain and language versions
+// as used by the go and toolchain directives, ie `1.19`,
+// `1.21.0` and `1.21rc1`. These are not semantic versions.
+package gover
+
+import (
+	"strconv"
+	"strings"
+)
+
+type version struct {
+	major, minor, patch string
+	// kind is `beta` or `rc` for prereleases, `` for language
+	// versions such as `1.21` and `.` for releases such as `1.21.0`.
+	kind string
+	pre  string
+}
+
+// IsValid reports if the value is a valid Go version.
+func IsValid(v string) bool {
+	_, ok := parse(v)
+	return ok
+}
+
+// Compare returns -1, 0 or 1 if x is less than, equal to or greater than y.
+// The language version `1.21` sorts before `1.21rc1` which sorts before `1.21.0`,
+// an invalid version sorts before every valid version.
+func Compare(x, y string) int {
+	vx, okx := parse(x)
+	vy, oky := parse(y)
+	switch {
+	case !okx && !oky:
+		return 0
+	case !okx:
+		return -1
+	case !oky:
+		return 1
+	}
+	if c := compareNum(vx.major, vy.major); c != 0 {
+		return c
+	}
+	if c := compareNum(vx.minor, vy.minor); c != 0 {
+		return c
+	}
+	if c := compareNum(vx.patch, vy.patch); c != 0 {
+		return c
+	}
+	if c := strings.Compare(vx.kind, vy.kind); c != 0 {
+		// "" < "beta" < "rc", releases are marked with "." so they
+		// are compared separately as it sorts before the letters.
+		switch {
+		case vx.kind == ".":
+			return 1
+		case vy.kind == ".":
+			return -1
+		}
+		return c
+	}
+	return compareNum(vx.pre, vy.pre)
+}
+
+// Max returns the greater of the two versions.
+func Max(x, y string) string {
+	if Compare(x, y) < 0 {
+		return y
+	}
+	return x
+}
+
+// Lang returns the language version, ie `1.21` for `1.21.3`.
+func Lang(v string) string {
+	ver, ok := parse(v)
+	if !ok {
+		return ""
+	}
+	if ver.minor == "" {
+		return ver.major
+	}
+	return ver.major + "." + ver.minor
+}
+
+func parse(s string) (version, bool) {
+	var v version
+	major, rest, ok := cutNum(s)
+	if !ok {
+		return version{}, false
+	}
+	v.major = major
+	if rest == "" {
+		return v, true
+	}
+	if rest[0] != '.' {
+		return version{}, false
+	}
+	minor, rest, ok := cutNum(rest[1:])
+	if !ok {
+		return version{}, false
+	}
+	v.minor = minor
+	switch {
+	case rest == "":
+		return v, true
+	case rest[0] == '.':
+		patch, rest, ok := cutNum(rest[1:])
+		if !ok || rest != "" {
+			return version{}, false
+		}
+		v.patch, v.kind = patch, "."
+		return v, true
+	}
+	for _, kind := range []string{"beta", "rc"} {
+		if strings.HasPrefix(rest, kind) {
+			pre, rest, ok := cutNum(strings.TrimPrefix(rest, kind))
+			if !ok || rest != "" {
+				return version{}, false
+			}
+			v.kind, v.pre = kind, pre
+			return v, true
+		}
+	}
+	return version{}, false
+}
+
+// cutNum splits the leading decimal number from s,
+// numbers with leading zeros are not valid.
+func cutNum(s string) (num, rest string, ok bool) {
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	if i == 0 || (i > 1 && s[0] == '0') {
+		return "", "", false
+	}
+	return s[:i], s[i:], true
+}
+
+func compareNum(x, y string) int {
+	if x == y {
+		return 0
+	}
+	nx, _ := strconv.Atoi(x)
+	ny, _ := strconv.Atoi(y)
+	switch {
+	case nx < ny:
+		return -1
+	case nx > ny:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+package gover
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		x, y   string
+		expect int
+	}{
+		{x: "1.19", y: "1.19", expect: 0},
+		{x: "1.19", y: "1.21", expect: -1},
+		{x: "1.21", y: "1.9", expect: 1},
+		{x: "1.21", y: "1.21rc1", expect: -1},
+		{x: "1.21beta1", y: "1.21rc1", expect: -1},
+		{x: "1.21rc2", y: "1.21rc1", expect: 1},
+		{x: "1.21rc1", y: "1.21.0", expect: -1},
+		{x: "1.21.0", y: "1.21", expect: 1},
+		{x: "1.21.10", y: "1.21.9", expect: 1},
+		{x: "2", y: "1.21.0", expect: 1},
+		{x: "invalid", y: "1.0", expect: -1},
+		{x: "invalid", y: "bad", expect: 0},
+	} {
+		assert.Equal(t, tc.expect, Compare(tc.x, tc.y), "Must compare %s with %s", tc.x, tc.y)
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	t.Parallel()
+
+	for v, valid := range map[string]bool{
+		"1":         true,
+		"1.19":      true,
+		"1.21.0":    true,
+		"1.21rc1":   true,
+		"1.21beta2": true,
+		"":          false,
+		"v1.19":     false,
+		"1.019":     false,
+		"1.21.":     false,
+		"1.21.0rc1": false,
+		"1.21alpha": false,
+		"1.21rc":    false,
+	} {
+		assert.Equal(t, valid, IsValid(v), "Must report if %q is valid", v)
+	}
+}
+
+func TestLang(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "1.21", Lang("1.21.3"), "Must trim the patch version")
+	assert.Equal(t, "1.21", Lang("1.21rc1"), "Must trim the prerelease")
+	assert.Equal(t, "1.19", Lang("1.19"), "Must keep the language version")
+	assert.Equal(t, "", Lang("invalid"), "Must be empty for invalid versions")
+}
@@ -5,59 +5,148 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 
 	"go.uber.org/multierr"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
 	"gopkg.in/yaml.v3"
 
+	"github.com/MovieStoreGuy/versionist/pkg/constraint"
 	"github.com/MovieStoreGuy/versionist/pkg/goproxy"
+	"github.com/MovieStoreGuy/versionist/pkg/internal/generic"
+	"github.com/MovieStoreGuy/versionist/pkg/internal/gover"
+	"github.com/MovieStoreGuy/versionist/pkg/toolchain"
 )
 
 const (
 	defaultVersion = "v0.0.0"
+	latestVersion  = "latest"
+	// ToolchainNone removes the toolchain directive from every module.
+	ToolchainNone = "none"
+	// ToolchainGoVersion is the first go version with the toolchain directive.
+	ToolchainGoVersion = "1.21"
+
+	// GoVersionExact sets the go directive of every module to the go version.
+	GoVersionExact GoVersionMode = "exact"
+	// GoVersionMinimum only raises go directives that are older than the go version.
+	GoVersionMinimum GoVersionMode = "minimum"
 
 	resolvePackage = "package"
 	resolveRegex   = "regexp:"
 )
 
 var (
-	ErrInvalidMatch = errors.New("invalid match")
+	ErrInvalidMatch      = errors.New("invalid match")
+	ErrNoMatchingVersion = errors.New("no matching version")
+	ErrRetracted         = errors.New("version retracted")
+	ErrUnresolved        = errors.New("unresolved version")
+	ErrIncompatibleGo    = errors.New("incompatible go version")
+	ErrInvalidToolchain  = errors.New("invalid toolchain")
+	ErrInvalidGoVersion  = errors.New("invalid go version")
 )
 
 type (
 	// Manifest describes the list of projects that
 	// should be matched and resolve to configured version
 	Manifest struct {
-		goproxy goproxy.Client `yaml:"-"`
+		goproxy   goproxy.Client     `yaml:"-"`
+		toolchain toolchain.Resolver `yaml:"-"`
+		// concurrency limits how many projects are resolved at once
+		concurrency int
 
 		GoVersion string     `yaml:"go_version"`
 		Projects  []*Project `yaml:"projects"`
+		// GoVersionMode controls how the go version is applied, defaulting to exact.
+		GoVersionMode GoVersionMode `yaml:"go_version_mode"`
+		// Toolchain is the toolchain directive set within every module,
+		// either a name such as `go1.21.3`, `latest` for the newest stable
+		// release, or `none` to remove it. Modules are unchanged when empty.
+		Toolchain string `yaml:"toolchain"`
+		// Ignore is a list of path patterns, relative to the manifest,
+		// that are skipped when searching for go.mod files.
+		Ignore []string `yaml:"ignore"`
+		// RejectRetracted causes projects pinned to an exact
+		// version that has been retracted to fail validation.
+		RejectRetracted bool `yaml:"reject_retracted"`
+		// Prerelease and PseudoVersions are the policies used
+		// by any project that does not configure its own.
+		Prerelease     PrereleasePolicy    `yaml:"prerelease"`
+		PseudoVersions PseudoVersionPolicy `yaml:"pseudo_versions"`
+		// Scope is the requirements updated by any project that does not configure its own.
+		Scope Scope `yaml:"scope"`
+		// Replace is the list of replace directives kept consistent across modules.
+		Replace []*Replace `yaml:"replace"`
+		// LocalReplaces replaces each requirement of a module within the
+		// repository with its directory and removes stale local replacements.
+		LocalReplaces bool `yaml:"local_replaces"`
+		// Exclude is the list of module versions excluded within every module.
+		Exclude []*Exclude `yaml:"exclude"`
 	}
 
 	ManifestOption func(m *Manifest)
 
+	// GoVersionMode is how the go directive of each module is updated.
+	GoVersionMode string
+
+	// ResolutionError is returned for each project whose
+	// configured version could not be resolved to an exact version.
+	ResolutionError struct {
+		Package string
+		// Version is the version as configured within the manifest
+		Version string
+		Err     error
+	}
+
 	// Project defines a a package with a version with a set of
 	// identifiers
 	Project struct {
 		// Name is the complete name for the repo being referenced
 		Package string `yaml:"package"`
-		// Version references the version to pin any matched projects to.
+		// Version references the version to pin any matched projects to,
+		// it can be an exact version, `latest`, or a constraint such as `^1.4`
+		// that is resolved to the highest satisfying version.
 		Version string `yaml:"version"`
 		// Match defines a set of expressions that are used to see
 		// if a project matches this definition.
 		Match []Matcher `yaml:"match"`
+		// GoCompatible resolves the newest version whose go directive
+		// does not exceed the manifest's go version, a pinned version
+		// that requires a newer go version fails validation.
+		GoCompatible bool `yaml:"go_compatible"`
+		// Prerelease and PseudoVersions restrict which versions
+		// can be resolved or pinned, overriding the manifest's policies.
+		Prerelease     PrereleasePolicy    `yaml:"prerelease"`
+		PseudoVersions PseudoVersionPolicy `yaml:"pseudo_versions"`
+		// Scope restricts the project to direct, indirect or all requirements.
+		Scope Scope `yaml:"scope"`
+		// Force adds the package as an indirect requirement to every module
+		// that transitively depends on it and updates existing requirements
+		// regardless of scope, raising the version used by the module graph.
+		Force bool `yaml:"force"`
+
+		constraint *constraint.Constraint
 	}
 
 	projectYAML struct {
-		Package string   `yaml:"package"`
-		Version string   `yaml:"version"`
-		Match   []string `yaml:"match"`
+		Package      string   `yaml:"package"`
+		Version      string   `yaml:"version"`
+		Match        []string `yaml:"match"`
+		GoCompatible bool     `yaml:"go_compatible"`
+
+		Prerelease     PrereleasePolicy    `yaml:"prerelease"`
+		PseudoVersions PseudoVersionPolicy `yaml:"pseudo_versions"`
+		Scope          Scope               `yaml:"scope"`
+		Force          bool                `yaml:"force"`
 	}
 )
 
 var (
 	_ yaml.Unmarshaler = (*Project)(nil)
+	_ yaml.Unmarshaler = (*GoVersionMode)(nil)
 )
 
 func WithGoProxyClient(c goproxy.Client) ManifestOption {
@@ -66,6 +155,21 @@ func WithGoProxyClient(c goproxy.Client) ManifestOption {
 	}
 }
 
+// WithConcurrency limits the number of projects resolved
+// at once, a limit less than one uses the number of CPUs.
+func WithConcurrency(limit int) ManifestOption {
+	return func(m *Manifest) {
+		m.concurrency = limit
+	}
+}
+
+// WithToolchainResolver sets how the `latest` toolchain is resolved.
+func WithToolchainResolver(r toolchain.Resolver) ManifestOption {
+	return func(m *Manifest) {
+		m.toolchain = r
+	}
+}
+
 // ReadManifest will load a yaml manifest from disk and
 // have it ready to be consumed, any issues trying to decode or read
 // will be returned as an error.
@@ -78,7 +182,8 @@ func ReadManifest(ctx context.Context, pathname string, opts ...ManifestOption)
 	dec.KnownFields(true)
 
 	manifest := &Manifest{
-		goproxy: goproxy.NewClient(),
+		goproxy:   goproxy.NewClient(),
+		toolchain: toolchain.NewResolver(),
 	}
 
 	for _, opt := range opts {
@@ -88,42 +193,295 @@ func ReadManifest(ctx context.Context, pathname string, opts ...ManifestOption)
 	err = multierr.Combine(
 		dec.Decode(manifest),
 		f.Close(),
-		manifest.resolveVersions(ctx),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := manifest.validateGoVersion(); err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range manifest.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("ignore pattern %q: %w", pattern, err)
+		}
+	}
+
+	if err := manifest.resolveToolchain(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := manifest.resolveVersions(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := manifest.resolveExcludes(ctx); err != nil {
+		return nil, err
+	}
+
 	return manifest, nil
 }
 
 func (m *Manifest) CheckProject(name string) (version string, matched bool) {
+	if p, ok := m.MatchProject(name); ok {
+		return p.Version, true
+	}
+	return defaultVersion, false
+}
+
+// MatchProject returns the first project that matches the module path.
+func (m *Manifest) MatchProject(name string) (*Project, bool) {
 	for _, p := range m.Projects {
 		if p.Check(name) {
-			return p.Version, true
+			return p, true
 		}
 	}
-	return defaultVersion, false
+	return nil, false
+}
+
+// validateGoVersion ensures the go version can be written as a go directive.
+func (m *Manifest) validateGoVersion() error {
+	if m.GoVersion == "" {
+		return fmt.Errorf("go_version is required: %w", ErrInvalidGoVersion)
+	}
+	if !modfile.GoVersionRE.MatchString(m.GoVersion) || !gover.IsValid(m.GoVersion) {
+		return fmt.Errorf("go_version %q: %w", m.GoVersion, ErrInvalidGoVersion)
+	}
+	if m.GoVersionMode == "" {
+		m.GoVersionMode = GoVersionExact
+	}
+	return nil
+}
+
+// resolveToolchain resolves the `latest` toolchain and ensures the
+// toolchain is a valid name that is not older than the go version.
+func (m *Manifest) resolveToolchain(ctx context.Context) error {
+	switch m.Toolchain {
+	case "", ToolchainNone:
+		return nil
+	}
+	if gover.Compare(m.GoVersion, ToolchainGoVersion) < 0 {
+		return fmt.Errorf("toolchain requires go %s or newer, not %s: %w", ToolchainGoVersion, m.GoVersion, ErrInvalidToolchain)
+	}
+	switch m.Toolchain {
+	case latestVersion:
+		name, err := m.toolchain.Latest(ctx)
+		if err != nil {
+			return fmt.Errorf("toolchain: %w", err)
+		}
+		m.Toolchain = name
+	}
+	if !strings.HasPrefix(m.Toolchain, "go") {
+		m.Toolchain = "go" + m.Toolchain
+	}
+	v := strings.TrimPrefix(m.Toolchain, "go")
+	if !gover.IsValid(v) {
+		return fmt.Errorf("toolchain %q: %w", m.Toolchain, ErrInvalidToolchain)
+	}
+	if gover.Compare(v, m.GoVersion) < 0 {
+		return fmt.Errorf("toolchain %s is older than go %s: %w", m.Toolchain, m.GoVersion, ErrInvalidToolchain)
+	}
+	return nil
 }
 
 func (m *Manifest) resolveVersions(ctx context.Context) error {
+	err := multierr.Combine(
+		m.checkRetracted(ctx),
+		m.checkGoCompatible(ctx),
+		m.checkPolicies(ctx),
+	)
+	if err != nil {
+		return err
+	}
 	packages := make([]string, 0, len(m.Projects))
 	for _, p := range m.Projects {
-		switch p.Version {
-		case "latest":
+		if p.Version == latestVersion && !m.fromCandidates(p) {
 			packages = append(packages, p.Package)
 		}
 	}
 	mappings, err := m.goproxy.GetLatest(ctx, packages...)
-	if err != nil {
-		return err
+	failed := goproxy.ModuleErrors(err)
+	// Errors not attributed to a module, such as a canceled context,
+	// are the cause for every project that was left unresolved.
+	var unattributed error
+	for _, err := range multierr.Errors(err) {
+		var me *goproxy.ModuleError
+		if !errors.As(err, &me) {
+			unattributed = multierr.Append(unattributed, err)
+		}
 	}
+	var errs error
 	for _, p := range m.Projects {
+		if p.Version != latestVersion || m.fromCandidates(p) {
+			continue
+		}
 		if v, ok := mappings[p.Package]; ok {
 			p.Version = v
+			continue
+		}
+		cause, ok := failed[p.Package]
+		if !ok {
+			cause = unattributed
 		}
+		errs = multierr.Append(errs, &ResolutionError{Package: p.Package, Version: p.Version, Err: cause})
 	}
-	return nil
+	errs = multierr.Append(errs, m.resolveCandidates(ctx))
+	if errs != nil {
+		return errs
+	}
+	// Guard against any version that can not be written to a go.mod
+	for _, p := range m.Projects {
+		if !isExactVersion(p.Version) {
+			errs = multierr.Append(errs, &ResolutionError{Package: p.Package, Version: p.Version})
+		}
+	}
+	return errs
+}
+
+// fromCandidates reports if the project's version is selected from the
+// module's published versions instead of the proxy's `@latest` version.
+func (m *Manifest) fromCandidates(p *Project) bool {
+	return p.constraint != nil || p.GoCompatible || m.hasPolicy(p)
+}
+
+// resolveCandidates resolves the projects that are selected from the
+// module's published versions, either by a constraint, by the version
+// policies or by requiring the version to be compatible with the
+// manifest's go version.
+func (m *Manifest) resolveCandidates(ctx context.Context) error {
+	return generic.ParallelRangeSlice(m.Projects, m.concurrency, func(_ int, p *Project) error {
+		if p.Version != latestVersion && p.constraint == nil {
+			return nil
+		}
+		if !m.fromCandidates(p) {
+			return nil
+		}
+		v, err := m.resolveCandidate(ctx, p)
+		if err != nil {
+			return &ResolutionError{Package: p.Package, Version: p.Version, Err: err}
+		}
+		p.Version = v
+		return nil
+	})
+}
+
+func (m *Manifest) resolveCandidate(ctx context.Context, p *Project) (string, error) {
+	versions, err := m.goproxy.List(ctx, p.Package)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 && p.constraint == nil {
+		// Modules without any tags only have a pseudo-version from `@latest`
+		latest, err := m.goproxy.GetLatest(ctx, p.Package)
+		if err != nil {
+			return "", err
+		}
+		if v, ok := latest[p.Package]; ok {
+			versions = append(versions, v)
+		}
+	}
+	retractions, err := m.goproxy.Retractions(ctx, p.Package)
+	if err != nil {
+		return "", err
+	}
+	includePrerelease := m.prereleasePolicy(p) != ""
+	candidates := make([]string, 0, len(versions))
+	for _, v := range m.filterPolicy(p, versions) {
+		if _, retracted := retractions.Retracted(v); retracted {
+			continue
+		}
+		switch {
+		case p.constraint == nil:
+		case includePrerelease && !p.constraint.CheckIncludePrerelease(v):
+			continue
+		case !includePrerelease && !p.constraint.Check(v):
+			continue
+		}
+		candidates = append(candidates, v)
+	}
+	if len(candidates) == 0 {
+		if p.constraint != nil {
+			return "", fmt.Errorf("%w satisfying %q", ErrNoMatchingVersion, p.constraint)
+		}
+		return "", ErrNoMatchingVersion
+	}
+	allowPrerelease := m.prereleasePolicy(p) == PrereleaseAllow
+	sortPreferred(candidates, allowPrerelease)
+	if !p.GoCompatible {
+		return candidates[0], nil
+	}
+	for _, v := range candidates {
+		if !allowPrerelease && semver.Prerelease(v) != "" && semver.Prerelease(candidates[0]) == "" {
+			// Prereleases are only candidates when there is no release, as done by `@latest`
+			break
+		}
+		goVersion, err := m.requiredGoVersion(ctx, p.Package, v)
+		if err != nil {
+			return "", err
+		}
+		if gover.Compare(goVersion, m.GoVersion) <= 0 {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("%w: every version requires a go version newer than %s", ErrIncompatibleGo, m.GoVersion)
+}
+
+// requiredGoVersion returns the go directive of the module's version,
+// modules without a go directive do not require a newer version.
+func (m *Manifest) requiredGoVersion(ctx context.Context, module, version string) (string, error) {
+	mod, err := m.goproxy.Mod(ctx, module, version)
+	if err != nil {
+		return "", err
+	}
+	if mod.Go == nil {
+		return "", nil
+	}
+	return mod.Go.Version, nil
+}
+
+// checkGoCompatible ensures that projects opting into go compatibility
+// and pinned to an exact version do not require a newer go version.
+func (m *Manifest) checkGoCompatible(ctx context.Context) (errs error) {
+	for _, p := range m.Projects {
+		if !p.GoCompatible || p.constraint != nil || !isExactVersion(p.Version) {
+			continue
+		}
+		goVersion, err := m.requiredGoVersion(ctx, p.Package, p.Version)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		if gover.Compare(goVersion, m.GoVersion) > 0 {
+			errs = multierr.Append(errs, fmt.Errorf("%s@%s requires go %s, newer than %s: %w", p.Package, p.Version, goVersion, m.GoVersion, ErrIncompatibleGo))
+		}
+	}
+	return errs
+}
+
+// checkRetracted ensures that no project that is pinned
+// to an exact version is using a retracted version.
+func (m *Manifest) checkRetracted(ctx context.Context) error {
+	if !m.RejectRetracted {
+		return nil
+	}
+	return generic.ParallelRangeSlice(m.Projects, m.concurrency, func(_ int, p *Project) error {
+		if p.constraint != nil || !isExactVersion(p.Version) {
+			return nil
+		}
+		retractions, err := m.goproxy.Retractions(ctx, p.Package)
+		if err != nil {
+			return err
+		}
+		r, retracted := retractions.Retracted(p.Version)
+		switch {
+		case !retracted:
+			return nil
+		case r.Rationale == "":
+			return fmt.Errorf("%s@%s: %w", p.Package, p.Version, ErrRetracted)
+		}
+		return fmt.Errorf("%s@%s: %w: %s", p.Package, p.Version, ErrRetracted, r.Rationale)
+	})
 }
 
 func (p *Project) Check(name string) bool {
@@ -141,7 +499,16 @@ func (p *Project) UnmarshalYAML(node *yaml.Node) error {
 		return err
 	}
 
-	p.Package, p.Version = val.Package, val.Version
+	p.Package, p.Version, p.GoCompatible = val.Package, val.Version, val.GoCompatible
+	p.Prerelease, p.PseudoVersions, p.Scope = val.Prerelease, val.PseudoVersions, val.Scope
+	p.Force = val.Force
+	if p.Version != latestVersion && !isExactVersion(p.Version) {
+		c, err := constraint.Parse(p.Version)
+		if err != nil {
+			return fmt.Errorf("project %s: %w", p.Package, err)
+		}
+		p.constraint = c
+	}
 	p.Match = append(p.Match, matchString(p.Package))
 	for _, v := range val.Match {
 		switch {
@@ -158,3 +525,52 @@ func (p *Project) UnmarshalYAML(node *yaml.Node) error {
 
 	return nil
 }
+
+func (re *ResolutionError) Error() string {
+	if re.Err == nil {
+		return fmt.Sprintf("%s@%s: %s", re.Package, re.Version, ErrUnresolved)
+	}
+	return fmt.Sprintf("%s@%s: %s: %v", re.Package, re.Version, ErrUnresolved, re.Err)
+}
+
+func (re *ResolutionError) Unwrap() error {
+	return re.Err
+}
+
+// Is allows the ResolutionError to match ErrUnresolved
+// while still unwrapping to the underlying cause.
+func (re *ResolutionError) Is(target error) bool {
+	return target == ErrUnresolved
+}
+
+// sortPreferred orders the versions from most to least preferred,
+// releases are preferred over prereleases as done by `@latest`
+// unless prereleases are allowed to be ordered by precedence.
+func sortPreferred(versions []string, allowPrerelease bool) {
+	sort.Slice(versions, func(i, j int) bool {
+		pi, pj := semver.Prerelease(versions[i]) != "", semver.Prerelease(versions[j]) != ""
+		if pi != pj && !allowPrerelease {
+			return pj
+		}
+		return semver.Compare(versions[i], versions[j]) > 0
+	})
+}
+
+func (gm *GoVersionMode) UnmarshalYAML(node *yaml.Node) error {
+	var val string
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+	switch mode := GoVersionMode(val); mode {
+	case GoVersionExact, GoVersionMinimum:
+		*gm = mode
+		return nil
+	}
+	return fmt.Errorf("go_version_mode %q: %w", val, ErrInvalidGoVersion)
+}
+
+// isExactVersion reports if the version can be
+// used as is within a go.mod file.
+func isExactVersion(v string) bool {
+	return semver.IsValid(v) && semver.Canonical(v)+semver.Build(v) == v
+}
@@ -2,18 +2,88 @@ package manifest
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"regexp"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+
+	"github.com/MovieStoreGuy/versionist/pkg/constraint"
+	"github.com/MovieStoreGuy/versionist/pkg/goproxy"
+	"github.com/MovieStoreGuy/versionist/pkg/toolchain"
 )
 
-type mockGoproxy struct{}
+type mockGoproxy struct {
+	goproxy.Client
+}
 
-func (mockGoproxy) GetLatest(context.Context, ...string) (map[string]string, error) {
-	return map[string]string{
+func (mockGoproxy) GetLatest(_ context.Context, projects ...string) (map[string]string, error) {
+	latest := map[string]string{
 		"uber.org/zap": "v1.90.0",
-	}, nil
+		"github.com/open-telemetry/opentelemetry-collector": "v0.62.0",
+		"github.com/awesome/untagged":                       "v0.0.0-20230101000000-abcdefabcdef",
+	}
+	var errs error
+	for _, p := range projects {
+		if _, ok := latest[p]; !ok {
+			errs = multierr.Append(errs, &goproxy.ModuleError{Module: p, Err: &goproxy.LookupError{
+				Module: p,
+				Suffix: "@latest",
+				Attempts: []goproxy.Attempt{
+					{Proxy: "https://proxy.golang.org", StatusCode: http.StatusNotFound, Err: errors.New("not found")},
+				},
+			}})
+		}
+	}
+	return latest, errs
+}
+
+func (mockGoproxy) List(_ context.Context, module string) ([]string, error) {
+	return map[string][]string{
+		"go.uber.org/zap": {"v1.20.0", "v1.21.0", "v1.23.0", "v1.23.1", "v1.24.0-rc.1", "v2.0.0"},
+		"github.com/open-telemetry/opentelemetry-collector": {"v0.60.0", "v0.61.0", "v0.61.1", "v0.62.0"},
+		"go.uber.org/multierr":                              {"v1.8.0", "v1.9.0-rc.1"},
+		"github.com/awesome/prerelease":                     {"v0.1.0-rc.1", "v0.1.0-rc.2"},
+	}[module], nil
+}
+
+func (mockGoproxy) Retractions(_ context.Context, module string) (goproxy.Retractions, error) {
+	return map[string]goproxy.Retractions{
+		"go.uber.org/zap": {
+			{Low: "v1.23.1", High: "v1.23.1", Rationale: "Drops log entries"},
+		},
+	}[module], nil
+}
+
+func (mockGoproxy) Mod(_ context.Context, module, version string) (*modfile.File, error) {
+	goVersion := map[string]string{
+		"go.uber.org/zap@v1.20.0":          "1.18",
+		"go.uber.org/zap@v1.21.0":          "1.19",
+		"go.uber.org/zap@v1.23.0":          "1.20",
+		"go.uber.org/zap@v1.24.0-rc.1":     "1.21",
+		"go.uber.org/zap@v2.0.0":           "1.21",
+		"go.uber.org/multierr@v1.8.0":      "1.20",
+		"go.uber.org/multierr@v1.9.0-rc.1": "1.19",
+	}[module+"@"+version]
+	content := "module " + module + "\n"
+	if goVersion != "" {
+		content += "\ngo " + goVersion + "\n"
+	}
+	return modfile.ParseLax("go.mod", []byte(content), nil)
+}
+
+func mustParseConstraint(t *testing.T, expr string) *constraint.Constraint {
+	t.Helper()
+	c, err := constraint.Parse(expr)
+	require.NoError(t, err, "Must be a valid constraint")
+	return c
 }
 
 func TestLoadingManifest(t *testing.T) {
@@ -40,16 +110,216 @@ func TestLoadingManifest(t *testing.T) {
 					},
 					{
 						Package: "github.com/open-telemetry/opentelemetry-collector",
-						Version: "latest",
+						Version: "v0.62.0",
 						Match: []Matcher{
 							matchString("github.com/open-telemetry/opentelemetry-collector"),
 							regexp.MustCompile("^github.com/open-telemetry/opentelemetry-collector/(.*)$"),
 						},
 					},
 				},
+				Ignore: []string{"examples/*"},
 			},
 			err: nil,
 		},
+		{
+			scenario: "version constraints",
+			path:     "testdata/constraints.yml",
+			manifest: &Manifest{
+				GoVersion: "1.19",
+				Projects: []*Project{
+					{
+						Package: "go.uber.org/zap",
+						Version: "v1.23.0",
+						Match: []Matcher{
+							matchString("go.uber.org/zap"),
+						},
+						constraint: mustParseConstraint(t, "^1.21"),
+					},
+					{
+						Package: "github.com/open-telemetry/opentelemetry-collector",
+						Version: "v0.61.1",
+						Match: []Matcher{
+							matchString("github.com/open-telemetry/opentelemetry-collector"),
+						},
+						constraint: mustParseConstraint(t, "~0.61.0"),
+					},
+				},
+			},
+			err: nil,
+		},
+		{
+			scenario: "invalid constraint",
+			path:     "testdata/invalid_constraint.yml",
+			err:      constraint.ErrInvalidConstraint,
+		},
+		{
+			scenario: "retracted pinned version",
+			path:     "testdata/retracted.yml",
+			err:      ErrRetracted,
+		},
+		{
+			scenario: "unsatisfiable constraint",
+			path:     "testdata/unsatisfiable.yml",
+			err:      ErrNoMatchingVersion,
+		},
+		{
+			scenario: "go compatible versions",
+			path:     "testdata/go_compatible.yml",
+			manifest: &Manifest{
+				GoVersion: "1.19",
+				Projects: []*Project{
+					{
+						Package: "go.uber.org/zap",
+						Version: "v1.21.0",
+						Match: []Matcher{
+							matchString("go.uber.org/zap"),
+						},
+						GoCompatible: true,
+					},
+					{
+						Package: "github.com/open-telemetry/opentelemetry-collector",
+						Version: "v0.61.1",
+						Match: []Matcher{
+							matchString("github.com/open-telemetry/opentelemetry-collector"),
+						},
+						GoCompatible: true,
+						constraint:   mustParseConstraint(t, "~0.61.0"),
+					},
+				},
+			},
+			err: nil,
+		},
+		{
+			scenario: "go incompatible pinned version",
+			path:     "testdata/go_incompatible.yml",
+			err:      ErrIncompatibleGo,
+		},
+		{
+			scenario: "go compatible latest without a prerelease fallback",
+			path:     "testdata/go_prerelease.yml",
+			err:      ErrIncompatibleGo,
+		},
+		{
+			scenario: "go compatible latest with prereleases allowed",
+			path:     "testdata/go_prerelease_allowed.yml",
+			manifest: &Manifest{
+				GoVersion: "1.19",
+				Projects: []*Project{
+					{
+						Package: "go.uber.org/multierr",
+						Version: "v1.9.0-rc.1",
+						Match: []Matcher{
+							matchString("go.uber.org/multierr"),
+						},
+						GoCompatible: true,
+						Prerelease:   PrereleaseAllow,
+					},
+				},
+			},
+		},
+		{
+			scenario: "version policies",
+			path:     "testdata/policies.yml",
+			manifest: &Manifest{
+				GoVersion: "1.19",
+				Projects: []*Project{
+					{
+						Package: "go.uber.org/zap",
+						Version: "v1.24.0-rc.1",
+						Match: []Matcher{
+							matchString("go.uber.org/zap"),
+						},
+						Prerelease: PrereleaseAllow,
+						constraint: mustParseConstraint(t, "^1.21"),
+					},
+					{
+						Package: "github.com/awesome/prerelease",
+						Version: "v0.1.0-rc.2",
+						Match: []Matcher{
+							matchString("github.com/awesome/prerelease"),
+						},
+						Prerelease: PrereleaseOnlyIfNoRelease,
+					},
+					{
+						Package: "github.com/awesome/untagged",
+						Version: "v0.0.0-20230101000000-abcdefabcdef",
+						Match: []Matcher{
+							matchString("github.com/awesome/untagged"),
+						},
+					},
+				},
+			},
+			err: nil,
+		},
+		{
+			scenario: "denied pseudo-version",
+			path:     "testdata/pseudo_denied.yml",
+			err:      ErrNoMatchingVersion,
+		},
+		{
+			scenario: "denied prerelease",
+			path:     "testdata/prerelease_denied.yml",
+			err:      ErrNoMatchingVersion,
+		},
+		{
+			scenario: "pinned prerelease with releases",
+			path:     "testdata/pinned_prerelease.yml",
+			err:      ErrPolicyViolation,
+		},
+		{
+			scenario: "invalid policy",
+			path:     "testdata/invalid_policy.yml",
+			err:      ErrInvalidPolicy,
+		},
+		{
+			scenario: "latest toolchain",
+			path:     "testdata/toolchain.yml",
+			manifest: &Manifest{
+				GoVersion: "1.21",
+				Toolchain: "go1.21.3",
+			},
+			err: nil,
+		},
+		{
+			scenario: "toolchain older than go version",
+			path:     "testdata/old_toolchain.yml",
+			err:      ErrInvalidToolchain,
+		},
+		{
+			scenario: "toolchain before go 1.21",
+			path:     "testdata/toolchain_old_go.yml",
+			err:      ErrInvalidToolchain,
+		},
+		{
+			scenario: "missing go version",
+			path:     "testdata/missing_go_version.yml",
+			err:      ErrInvalidGoVersion,
+		},
+		{
+			scenario: "invalid go version",
+			path:     "testdata/invalid_go_version.yml",
+			err:      ErrInvalidGoVersion,
+		},
+		{
+			scenario: "invalid go version mode",
+			path:     "testdata/invalid_go_version_mode.yml",
+			err:      ErrInvalidGoVersion,
+		},
+		{
+			scenario: "invalid scope",
+			path:     "testdata/invalid_scope.yml",
+			err:      ErrInvalidPolicy,
+		},
+		{
+			scenario: "invalid replace",
+			path:     "testdata/invalid_replace.yml",
+			err:      ErrInvalidReplace,
+		},
+		{
+			scenario: "unresolved latest version",
+			path:     "testdata/unresolved.yml",
+			err:      ErrUnresolved,
+		},
 	} {
 		tc := tc
 		t.Run(tc.scenario, func(t *testing.T) {
@@ -57,10 +327,16 @@ func TestLoadingManifest(t *testing.T) {
 
 			m, err := ReadManifest(context.Background(), tc.path,
 				WithGoProxyClient(mockGoproxy{}),
+				WithToolchainResolver(toolchain.NewResolver(toolchain.WithListingSource("testdata/dl.json"))),
 			)
 			assert.ErrorIs(t, err, tc.err, "Must match the expected error")
+			if tc.err != nil {
+				return
+			}
 			assert.EqualValues(t, tc.manifest.GoVersion, m.GoVersion, "Must match the expected value")
+			assert.EqualValues(t, tc.manifest.Toolchain, m.Toolchain, "Must match the expected value")
 			assert.EqualValues(t, tc.manifest.Projects, m.Projects, "Must match the expected value")
+			assert.EqualValues(t, tc.manifest.Ignore, m.Ignore, "Must match the expected value")
 		})
 	}
 }
@@ -120,3 +396,130 @@ func TestCheckingProject(t *testing.T) {
 	}
 
 }
+
+func TestRejectingRetractedVersion(t *testing.T) {
+	t.Parallel()
+
+	_, err := ReadManifest(context.Background(), "testdata/retracted.yml",
+		WithGoProxyClient(mockGoproxy{}),
+	)
+	assert.ErrorIs(t, err, ErrRetracted, "Must error with a retracted version")
+	assert.EqualError(t, err, "go.uber.org/zap@v1.23.1: version retracted: Drops log entries", "Must include the retraction rationale")
+}
+
+// inflightGoproxy records the most List calls made at once
+type inflightGoproxy struct {
+	mockGoproxy
+
+	mu             *sync.Mutex
+	inflight, peak *int
+}
+
+func (ig inflightGoproxy) List(ctx context.Context, module string) ([]string, error) {
+	ig.mu.Lock()
+	if *ig.inflight++; *ig.inflight > *ig.peak {
+		*ig.peak = *ig.inflight
+	}
+	ig.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	ig.mu.Lock()
+	*ig.inflight--
+	ig.mu.Unlock()
+	return ig.mockGoproxy.List(ctx, module)
+}
+
+func TestResolvingConcurrently(t *testing.T) {
+	t.Parallel()
+
+	for _, limit := range []int{1, 2} {
+		var (
+			mu             sync.Mutex
+			inflight, peak int
+		)
+		m, err := ReadManifest(context.Background(), "testdata/constraints.yml",
+			WithGoProxyClient(inflightGoproxy{mu: &mu, inflight: &inflight, peak: &peak}),
+			WithConcurrency(limit),
+		)
+		require.NoError(t, err, "Must read the manifest")
+		assert.LessOrEqual(t, peak, limit, "Must not exceed the concurrency limit of %d", limit)
+		assert.Equal(t, "v1.23.0", m.Projects[0].Version, "Must resolve each project in order")
+		assert.Equal(t, "v0.61.1", m.Projects[1].Version, "Must resolve each project in order")
+	}
+}
+
+func TestUnresolvedLatestVersion(t *testing.T) {
+	t.Parallel()
+
+	_, err := ReadManifest(context.Background(), "testdata/unresolved.yml",
+		WithGoProxyClient(mockGoproxy{}),
+	)
+	require.ErrorIs(t, err, ErrUnresolved, "Must error when a version can not be resolved")
+
+	var re *ResolutionError
+	require.ErrorAs(t, err, &re, "Must be a resolution error")
+	assert.Equal(t, "github.com/awesome/missing", re.Package, "Must reference the unresolved project")
+	assert.Equal(t, "latest", re.Version, "Must reference the configured version")
+
+	var lookup *goproxy.LookupError
+	require.ErrorAs(t, err, &lookup, "Must include the proxies attempted")
+	assert.EqualError(t, err,
+		"github.com/awesome/missing@latest: unresolved version: github.com/awesome/missing/@latest: https://proxy.golang.org (status 404)",
+		"Must list each proxy with its status code",
+	)
+}
+
+// canceledGoproxy fails to resolve any latest version without attributing the error to a module
+type canceledGoproxy struct {
+	mockGoproxy
+}
+
+func (canceledGoproxy) GetLatest(context.Context, ...string) (map[string]string, error) {
+	return nil, context.Canceled
+}
+
+func TestUnattributedLatestError(t *testing.T) {
+	t.Parallel()
+
+	_, err := ReadManifest(context.Background(), "testdata/unresolved.yml",
+		WithGoProxyClient(canceledGoproxy{}),
+	)
+	require.ErrorIs(t, err, ErrUnresolved, "Must error when a version can not be resolved")
+	assert.ErrorIs(t, err, context.Canceled, "Must include the error not attributed to a module")
+	assert.Len(t, multierr.Errors(err), 2, "Must report each unresolved project")
+}
+
+func TestReadingReplace(t *testing.T) {
+	t.Parallel()
+
+	m, err := ReadManifest(context.Background(), "testdata/replace.yml",
+		WithGoProxyClient(mockGoproxy{}),
+	)
+	require.NoError(t, err, "Must read the manifest")
+	assert.Equal(t, []*Replace{
+		{Old: module.Version{Path: "github.com/awesome/old"}, New: module.Version{Path: "forks/old"}},
+		{Old: module.Version{Path: "github.com/awesome/other", Version: "v1.0.0"}, New: module.Version{Path: "github.com/fork/other", Version: "v1.1.0"}},
+		{Old: module.Version{Path: "github.com/awesome/removed"}},
+	}, m.Replace, "Must match the expected replacements")
+	assert.True(t, m.Replace[0].Local(), "Must be a local replacement")
+	assert.True(t, m.Replace[2].Remove(), "Must remove the replacement")
+}
+
+func TestReadingExclude(t *testing.T) {
+	t.Parallel()
+
+	m, err := ReadManifest(context.Background(), "testdata/exclude.yml",
+		WithGoProxyClient(mockGoproxy{}),
+	)
+	require.NoError(t, err, "Must read the manifest")
+	require.Len(t, m.Exclude, 3, "Must read each exclude")
+	assert.Equal(t, []string{"v0.61.0"}, m.Exclude[0].Versions, "Must exclude the exact version")
+	assert.Equal(t, []string{"v1.23.0", "v1.23.1"}, m.Exclude[1].Versions, "Must expand the constraint against the listed versions")
+	assert.Empty(t, m.Exclude[2].Versions, "Must not exclude any version without a version")
+
+	_, err = ReadManifest(context.Background(), "testdata/unsatisfiable_exclude.yml",
+		WithGoProxyClient(mockGoproxy{}),
+	)
+	assert.ErrorIs(t, err, ErrNoMatchingVersion, "Must error when no version matches the constraint")
+}
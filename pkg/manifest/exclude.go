@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/multierr"
+	"golang.org/x/mod/module"
+	"gopkg.in/yaml.v3"
+
+	"github.com/MovieStoreGuy/versionist/pkg/constraint"
+)
+
+type (
+	// Exclude blocks versions of a module within every go.mod,
+	// the version is either exact or a constraint that is expanded
+	// to each matching version listed by the proxy. Without a version
+	// every exclude of the module is removed.
+	Exclude struct {
+		Package string `yaml:"package"`
+		Version string `yaml:"version"`
+		// Versions are the exact versions that are excluded
+		Versions []string `yaml:"-"`
+
+		constraint *constraint.Constraint
+	}
+
+	excludeYAML struct {
+		Package string `yaml:"package"`
+		Version string `yaml:"version"`
+	}
+)
+
+var (
+	_ yaml.Unmarshaler = (*Exclude)(nil)
+)
+
+func (e *Exclude) UnmarshalYAML(node *yaml.Node) error {
+	val := excludeYAML{}
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+	if err := module.CheckImportPath(val.Package); err != nil {
+		return fmt.Errorf("exclude %s: %w", val.Package, err)
+	}
+	e.Package, e.Version = val.Package, val.Version
+	if e.Version == "" {
+		return nil
+	}
+	if isExactVersion(e.Version) {
+		e.Versions = []string{e.Version}
+		return nil
+	}
+	c, err := constraint.Parse(e.Version)
+	if err != nil {
+		return fmt.Errorf("exclude %s: %w", e.Package, err)
+	}
+	e.constraint = c
+	return nil
+}
+
+// resolveExcludes expands each constraint to the versions
+// listed by the proxy, prereleases are included so a broken
+// release candidate is excluded along with its release.
+func (m *Manifest) resolveExcludes(ctx context.Context) (errs error) {
+	for _, e := range m.Exclude {
+		if e.constraint == nil {
+			continue
+		}
+		versions, err := m.goproxy.List(ctx, e.Package)
+		if err != nil {
+			errs = multierr.Append(errs, &ResolutionError{Package: e.Package, Version: e.Version, Err: err})
+			continue
+		}
+		for _, v := range versions {
+			if e.constraint.CheckIncludePrerelease(v) {
+				e.Versions = append(e.Versions, v)
+			}
+		}
+		if len(e.Versions) == 0 {
+			errs = multierr.Append(errs, &ResolutionError{Package: e.Package, Version: e.Version, Err: ErrNoMatchingVersion})
+		}
+	}
+	return errs
+}
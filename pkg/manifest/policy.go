@@ -0,0 +1,204 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+
+	"github.com/MovieStoreGuy/versionist/pkg/internal/generic"
+)
+
+const (
+	// PrereleaseAllow treats prereleases the same as releases.
+	PrereleaseAllow PrereleasePolicy = "allow"
+	// PrereleaseDeny never resolves to, or allows pinning, a prerelease.
+	PrereleaseDeny PrereleasePolicy = "deny"
+	// PrereleaseOnlyIfNoRelease only uses a prerelease when
+	// the module has not published any release.
+	PrereleaseOnlyIfNoRelease PrereleasePolicy = "only-if-no-release"
+
+	// PseudoVersionAllow allows versions of untagged commits.
+	PseudoVersionAllow PseudoVersionPolicy = "allow"
+	// PseudoVersionDeny never resolves to, or allows pinning, a pseudo-version.
+	PseudoVersionDeny PseudoVersionPolicy = "deny"
+
+	// ScopeDirect only updates direct requirements.
+	ScopeDirect Scope = "direct"
+	// ScopeIndirect only updates requirements marked `// indirect`.
+	ScopeIndirect Scope = "indirect"
+	// ScopeAll updates both direct and indirect requirements.
+	ScopeAll Scope = "all"
+)
+
+var (
+	ErrInvalidPolicy   = errors.New("invalid policy")
+	ErrPolicyViolation = errors.New("version policy violation")
+)
+
+type (
+	// PrereleasePolicy controls if prerelease versions, such as `v1.2.0-rc.1`,
+	// can be used. An unset policy keeps the default behaviour of `latest`
+	// and constraints, which only use a prerelease when there is no release
+	// or the constraint references one.
+	PrereleasePolicy string
+
+	// PseudoVersionPolicy controls if pseudo-versions of untagged commits can be used,
+	// an unset policy allows them.
+	PseudoVersionPolicy string
+
+	// Scope controls which requirements of a go.mod a project updates,
+	// an unset scope only updates direct requirements.
+	Scope string
+)
+
+var (
+	_ yaml.Unmarshaler = (*PrereleasePolicy)(nil)
+	_ yaml.Unmarshaler = (*PseudoVersionPolicy)(nil)
+	_ yaml.Unmarshaler = (*Scope)(nil)
+)
+
+func (pp *PrereleasePolicy) UnmarshalYAML(node *yaml.Node) error {
+	var val string
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+	switch policy := PrereleasePolicy(val); policy {
+	case PrereleaseAllow, PrereleaseDeny, PrereleaseOnlyIfNoRelease:
+		*pp = policy
+		return nil
+	}
+	return fmt.Errorf("prerelease %q: %w", val, ErrInvalidPolicy)
+}
+
+func (pp *PseudoVersionPolicy) UnmarshalYAML(node *yaml.Node) error {
+	var val string
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+	switch policy := PseudoVersionPolicy(val); policy {
+	case PseudoVersionAllow, PseudoVersionDeny:
+		*pp = policy
+		return nil
+	}
+	return fmt.Errorf("pseudo_versions %q: %w", val, ErrInvalidPolicy)
+}
+
+func (s *Scope) UnmarshalYAML(node *yaml.Node) error {
+	var val string
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+	switch scope := Scope(val); scope {
+	case ScopeDirect, ScopeIndirect, ScopeAll:
+		*s = scope
+		return nil
+	}
+	return fmt.Errorf("scope %q: %w", val, ErrInvalidPolicy)
+}
+
+// Includes reports if a requirement, marked as indirect or not, is within the scope.
+func (s Scope) Includes(indirect bool) bool {
+	switch s {
+	case ScopeAll:
+		return true
+	case ScopeIndirect:
+		return indirect
+	}
+	return !indirect
+}
+
+// ProjectScope returns the project's scope, falling back to the manifest's.
+func (m *Manifest) ProjectScope(p *Project) Scope {
+	switch {
+	case p.Scope != "":
+		return p.Scope
+	case m.Scope != "":
+		return m.Scope
+	}
+	return ScopeDirect
+}
+
+// prereleasePolicy returns the project's policy, falling back to the manifest's.
+func (m *Manifest) prereleasePolicy(p *Project) PrereleasePolicy {
+	if p.Prerelease != "" {
+		return p.Prerelease
+	}
+	return m.Prerelease
+}
+
+// pseudoVersionPolicy returns the project's policy, falling back to the manifest's.
+func (m *Manifest) pseudoVersionPolicy(p *Project) PseudoVersionPolicy {
+	if p.PseudoVersions != "" {
+		return p.PseudoVersions
+	}
+	return m.PseudoVersions
+}
+
+// hasPolicy reports if the project's versions need to be
+// filtered rather than using the proxy's `@latest` version.
+func (m *Manifest) hasPolicy(p *Project) bool {
+	return m.prereleasePolicy(p) != "" || m.pseudoVersionPolicy(p) != ""
+}
+
+// filterPolicy removes any versions not allowed by the project's policies.
+func (m *Manifest) filterPolicy(p *Project, versions []string) []string {
+	prerelease, released := m.prereleasePolicy(p), hasRelease(versions)
+	allowed := make([]string, 0, len(versions))
+	for _, v := range versions {
+		switch {
+		case module.IsPseudoVersion(v):
+			if m.pseudoVersionPolicy(p) == PseudoVersionDeny {
+				continue
+			}
+		case semver.Prerelease(v) != "":
+			if prerelease == PrereleaseDeny || (prerelease == PrereleaseOnlyIfNoRelease && released) {
+				continue
+			}
+		}
+		allowed = append(allowed, v)
+	}
+	return allowed
+}
+
+// checkPolicies ensures that projects pinned
+// to an exact version follow the configured policies.
+func (m *Manifest) checkPolicies(ctx context.Context) error {
+	return generic.ParallelRangeSlice(m.Projects, m.concurrency, func(_ int, p *Project) error {
+		if p.constraint != nil || !isExactVersion(p.Version) {
+			return nil
+		}
+		switch {
+		case module.IsPseudoVersion(p.Version):
+			if m.pseudoVersionPolicy(p) == PseudoVersionDeny {
+				return fmt.Errorf("%s@%s is a pseudo-version: %w", p.Package, p.Version, ErrPolicyViolation)
+			}
+		case semver.Prerelease(p.Version) != "":
+			switch m.prereleasePolicy(p) {
+			case PrereleaseDeny:
+				return fmt.Errorf("%s@%s is a prerelease: %w", p.Package, p.Version, ErrPolicyViolation)
+			case PrereleaseOnlyIfNoRelease:
+				versions, err := m.goproxy.List(ctx, p.Package)
+				if err != nil {
+					return err
+				}
+				if hasRelease(versions) {
+					return fmt.Errorf("%s@%s is a prerelease of a module with releases: %w", p.Package, p.Version, ErrPolicyViolation)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func hasRelease(versions []string) bool {
+	for _, v := range versions {
+		if semver.Prerelease(v) == "" {
+			return true
+		}
+	}
+	return false
+}
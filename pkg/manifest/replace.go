@@ -0,0 +1,92 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidReplace = errors.New("invalid replace")
+)
+
+type (
+	// Replace is a replace directive applied to every module
+	// that requires, or already replaces, the old module path.
+	Replace struct {
+		// Old is the replaced module, an empty version replaces every version
+		Old module.Version
+		// New is either a module path and version, or a directory relative
+		// to the manifest without a version. An empty path removes the replacement.
+		New module.Version
+	}
+
+	replaceYAML struct {
+		Old string `yaml:"old"`
+		New string `yaml:"new"`
+	}
+)
+
+var (
+	_ yaml.Unmarshaler = (*Replace)(nil)
+)
+
+func (r *Replace) UnmarshalYAML(node *yaml.Node) error {
+	val := replaceYAML{}
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+	old, err := parseModuleVersion(val.Old)
+	if err != nil {
+		return fmt.Errorf("replace old %q: %w", val.Old, err)
+	}
+	r.Old = old
+
+	switch {
+	case val.New == "":
+		r.New = module.Version{}
+	case isLocalPath(val.New):
+		r.New = module.Version{Path: path.Clean(val.New)}
+	default:
+		r.New, err = parseModuleVersion(val.New)
+		if err != nil {
+			return fmt.Errorf("replace new %q: %w", val.New, err)
+		}
+		if r.New.Version == "" {
+			return fmt.Errorf("replace new %q requires a version: %w", val.New, ErrInvalidReplace)
+		}
+	}
+	return nil
+}
+
+// Local reports if the module is replaced by a directory within the repository.
+func (r *Replace) Local() bool {
+	return r.New.Path != "" && r.New.Version == ""
+}
+
+// Remove reports if the replacement should be removed from every module.
+func (r *Replace) Remove() bool {
+	return r.New.Path == ""
+}
+
+// parseModuleVersion reads `path` or `path@version`.
+func parseModuleVersion(s string) (module.Version, error) {
+	p, v, _ := strings.Cut(s, "@")
+	if err := module.CheckImportPath(p); err != nil {
+		return module.Version{}, fmt.Errorf("%v: %w", err, ErrInvalidReplace)
+	}
+	if v != "" && (!semver.IsValid(v) || semver.Canonical(v)+semver.Build(v) != v) {
+		return module.Version{}, fmt.Errorf("version %q is not canonical: %w", v, ErrInvalidReplace)
+	}
+	return module.Version{Path: p, Version: v}, nil
+}
+
+// isLocalPath reports if the path is relative to the manifest.
+func isLocalPath(p string) bool {
+	return p == "." || p == ".." || strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../")
+}
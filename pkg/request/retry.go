@@ -0,0 +1,197 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// RetryPolicy defines how idempotent requests are retried
+// using jittered exponential backoff.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first.
+	Attempts int
+	// BaseDelay is the wait before the first retry, doubling for each retry after.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between attempts, including any Retry-After value.
+	MaxDelay time.Duration
+	// Timeout bounds each attempt, including reading the response body.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used
+// when a retry policy has not been configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  3,
+		BaseDelay: 250 * time.Millisecond,
+		MaxDelay:  10 * time.Second,
+		Timeout:   30 * time.Second,
+	}
+}
+
+// StatusError is returned by Get when the response is not 200 OK.
+type StatusError struct {
+	URL    string
+	Code   int
+	Header http.Header
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("%s returned status code %d", se.URL, se.Code)
+}
+
+// Do calls attempt until it succeeds, its failure is not retryable, or the attempts
+// are used up, each call is bounded by the policy's timeout. A failed attempt returns
+// the response status code and header, or a zero code when there was no response.
+func (rp RetryPolicy) Do(ctx context.Context, log *zap.Logger, attempt func(ctx context.Context) (int, http.Header, error)) error {
+	for n := 1; ; n++ {
+		code, header, err := rp.attempt(ctx, attempt)
+		if err == nil || ctx.Err() != nil || n >= rp.Attempts || !rp.Retryable(code, err) {
+			return err
+		}
+
+		wait := rp.Backoff(n, code, header)
+		log.Warn("Retrying request",
+			zap.Int("attempt", n),
+			zap.Duration("wait", wait),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return multierr.Append(err, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Get returns the body of a 200 OK response to a GET request of the url,
+// retrying failed requests with the policy.
+func (rp RetryPolicy) Get(ctx context.Context, log *zap.Logger, client *http.Client, rf Factory, url string) ([]byte, error) {
+	var content []byte
+	err := rp.Do(ctx, log.With(zap.String("url", url)), func(ctx context.Context) (int, http.Header, error) {
+		req, err := rf.NewRequest(ctx, http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return 0, nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, resp.Header, multierr.Append(
+				&StatusError{URL: url, Code: resp.StatusCode, Header: resp.Header},
+				resp.Body.Close(),
+			)
+		}
+		content, err = io.ReadAll(resp.Body)
+		return 0, nil, multierr.Append(err, resp.Body.Close())
+	})
+	return content, err
+}
+
+func (rp RetryPolicy) attempt(ctx context.Context, attempt func(ctx context.Context) (int, http.Header, error)) (int, http.Header, error) {
+	if rp.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rp.Timeout)
+		defer cancel()
+	}
+	return attempt(ctx)
+}
+
+// Retryable reports if a failed attempt should be retried, code is the
+// response status code or zero when the request failed without a response.
+// Without a response only network errors and timeouts are retried.
+func (rp RetryPolicy) Retryable(code int, err error) bool {
+	switch code {
+	case 0:
+		return networkError(err)
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Backoff returns the wait before the next attempt after the given attempt number.
+// A Retry-After header on a 429 or 503 response is used instead of the exponential delay.
+func (rp RetryPolicy) Backoff(attempt int, code int, header http.Header) time.Duration {
+	if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+		if wait, ok := retryAfter(header); ok {
+			return rp.limit(wait)
+		}
+	}
+	if rp.BaseDelay <= 0 {
+		return 0
+	}
+	wait := rp.BaseDelay << (attempt - 1)
+	if wait <= 0 {
+		wait = rp.MaxDelay
+	}
+	wait = rp.limit(wait)
+	// Equal jitter, waiting between half and all of the delay, avoids synchronised retries.
+	half := int64(wait / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// networkError reports if the request failed because of the network, such as
+// a timeout or a dropped connection, rather than an error that will not change
+// when retried, like an invalid request or an untrusted certificate.
+func networkError(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET):
+		return true
+	}
+	// url.Error implements net.Error for any failed
+	// request so only the error it wraps is checked.
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		err = uerr.Err
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
+
+func (rp RetryPolicy) limit(wait time.Duration) time.Duration {
+	if rp.MaxDelay > 0 && wait > rp.MaxDelay {
+		return rp.MaxDelay
+	}
+	return wait
+}
+
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,112 @@
+package request
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRetryable(t *testing.T) {
+	t.Parallel()
+
+	policy := DefaultRetryPolicy()
+	for _, tc := range []struct {
+		code      int
+		err       error
+		retryable bool
+	}{
+		{code: 0, err: &url.Error{Op: "Get", URL: "https://proxy.golang.org", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}, retryable: true},
+		{code: 0, err: &url.Error{Op: "Get", URL: "https://proxy.golang.org", Err: context.DeadlineExceeded}, retryable: true},
+		{code: 0, err: fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), retryable: true},
+		{code: 0, err: &url.Error{Op: "Get", URL: "https://proxy.golang.org", Err: x509.UnknownAuthorityError{}}, retryable: false},
+		{code: 0, err: &url.Error{Op: "parse", URL: "://proxy", Err: errors.New("missing protocol scheme")}, retryable: false},
+		{code: 0, err: errors.New("invalid request"), retryable: false},
+		{code: 0, retryable: false},
+		{code: http.StatusTooManyRequests, retryable: true},
+		{code: http.StatusBadGateway, retryable: true},
+		{code: http.StatusServiceUnavailable, retryable: true},
+		{code: http.StatusNotFound, retryable: false},
+		{code: http.StatusGone, retryable: false},
+		{code: http.StatusUnauthorized, retryable: false},
+	} {
+		assert.Equal(t, tc.retryable, policy.Retryable(tc.code, tc.err), "Must match expected result for %d: %v", tc.code, tc.err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{
+		Attempts:  5,
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+	}
+
+	for attempt, max := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second,
+	} {
+		wait := policy.Backoff(attempt, http.StatusBadGateway, http.Header{})
+		assert.GreaterOrEqual(t, wait, max/2, "Must wait at least half the delay for attempt %d", attempt)
+		assert.LessOrEqual(t, wait, max, "Must not exceed the delay for attempt %d", attempt)
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", "1")
+	assert.Equal(t, time.Second, policy.Backoff(1, http.StatusTooManyRequests, header), "Must honor Retry-After seconds")
+
+	header.Set("Retry-After", "120")
+	assert.Equal(t, time.Second, policy.Backoff(1, http.StatusServiceUnavailable, header), "Must cap Retry-After to the max delay")
+
+	header.Set("Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.Equal(t, time.Duration(0), policy.Backoff(1, http.StatusServiceUnavailable, header), "Must honor Retry-After dates")
+
+	header.Set("Retry-After", "1")
+	assert.LessOrEqual(t, policy.Backoff(1, http.StatusBadGateway, header), 100*time.Millisecond, "Must ignore Retry-After for other status codes")
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	var requests, missing int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/missing":
+			atomic.AddInt32(&missing, 1)
+			http.NotFound(w, r)
+		case atomic.AddInt32(&requests, 1) < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = io.WriteString(w, "content")
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	policy := RetryPolicy{Attempts: 3, Timeout: time.Second}
+	content, err := policy.Get(context.Background(), zaptest.NewLogger(t), s.Client(), NewRequestFactory(), s.URL+"/content")
+	assert.NoError(t, err, "Must not error once the server recovers")
+	assert.Equal(t, "content", string(content), "Must return the response body")
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests), "Must retry unavailable responses")
+
+	_, err = policy.Get(context.Background(), zaptest.NewLogger(t), s.Client(), NewRequestFactory(), s.URL+"/missing")
+	var se *StatusError
+	if assert.ErrorAs(t, err, &se, "Must return the status error") {
+		assert.Equal(t, http.StatusNotFound, se.Code, "Must match the response status code")
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&missing), "Must not retry not found responses")
+}
@@ -0,0 +1,161 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+
+	"github.com/MovieStoreGuy/versionist/pkg/goproxy"
+)
+
+type (
+	// graph walks the module requirement graph using the go.mod files
+	// of each module version from the proxy, or from disk for modules
+	// within the tree and directory replacements.
+	graph struct {
+		client goproxy.Client
+		log    *zap.Logger
+
+		mu   sync.Mutex
+		reqs map[node][]module.Version
+	}
+
+	// node is a module version read from the proxy,
+	// or a module directory read from disk when dir is set.
+	node struct {
+		mv  module.Version
+		dir string
+	}
+)
+
+func newGraph(client goproxy.Client, log *zap.Logger) *graph {
+	return &graph{client: client, log: log, reqs: make(map[node][]module.Version)}
+}
+
+// requirements returns the modules required by the node.
+func (g *graph) requirements(ctx context.Context, n node) ([]module.Version, error) {
+	g.mu.Lock()
+	reqs, ok := g.reqs[n]
+	g.mu.Unlock()
+	if ok {
+		return reqs, nil
+	}
+
+	var (
+		mod *modfile.File
+		err error
+	)
+	switch n.dir {
+	case "":
+		mod, err = g.client.Mod(ctx, n.mv.Path, n.mv.Version)
+	default:
+		var content []byte
+		name := filepath.Join(n.dir, ModFilename)
+		if content, err = os.ReadFile(name); err == nil {
+			mod, err = modfile.ParseLax(name, content, nil)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	reqs = make([]module.Version, 0, len(mod.Require))
+	for _, r := range mod.Require {
+		reqs = append(reqs, r.Mod)
+	}
+
+	g.mu.Lock()
+	g.reqs[n] = reqs
+	g.mu.Unlock()
+	return reqs, nil
+}
+
+// reaches returns which of the target module paths are transitively required
+// by the module at name. Requirements on modules within the tree, given as
+// locals mapping the module path to its directory, and directory replacements
+// are read from disk. A directory without a go.mod, such as a package path
+// within a local module, is skipped as it can never be published.
+func (g *graph) reaches(ctx context.Context, name string, mod *modfile.File, locals map[string]string, targets map[string]struct{}) (map[string]bool, error) {
+	dir := filepath.Dir(name)
+	resolve := func(mv module.Version) node {
+		for _, r := range mod.Replace {
+			if r.Old.Path != mv.Path || (r.Old.Version != "" && r.Old.Version != mv.Version) {
+				continue
+			}
+			if r.New.Version == "" {
+				return node{dir: filepath.Join(dir, filepath.FromSlash(r.New.Path))}
+			}
+			return node{mv: r.New}
+		}
+		if local, ok := localDir(locals, mv.Path); ok {
+			return node{dir: local}
+		}
+		return node{mv: mv}
+	}
+
+	var (
+		found = make(map[string]bool)
+		seen  = make(map[node]struct{})
+		queue []module.Version
+	)
+	for _, r := range mod.Require {
+		queue = append(queue, r.Mod)
+	}
+	for len(queue) > 0 && len(found) < len(targets) {
+		mv := queue[0]
+		queue = queue[1:]
+		if _, ok := targets[mv.Path]; ok {
+			found[mv.Path] = true
+		}
+		n := resolve(mv)
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		reqs, err := g.requirements(ctx, n)
+		if n.dir != "" && errors.Is(err, fs.ErrNotExist) {
+			g.log.Debug("Skipping directory without a go.mod",
+				zap.String("path", name),
+				zap.String("module", mv.String()),
+				zap.String("dir", n.dir),
+			)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, reqs...)
+	}
+	return found, nil
+}
+
+// localDir returns the directory of the module path when it is within the
+// tree, either as a local module or an existing directory nested in one.
+// Nested paths without a directory, like a major version suffix, are left
+// to the proxy.
+func localDir(locals map[string]string, path string) (string, bool) {
+	if dir, ok := locals[path]; ok {
+		return dir, true
+	}
+	for prefix := path; ; {
+		i := strings.LastIndex(prefix, "/")
+		if i < 0 {
+			return "", false
+		}
+		prefix = prefix[:i]
+		if dir, ok := locals[prefix]; ok {
+			dir = filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(path, prefix+"/")))
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				return "", false
+			}
+			return dir, true
+		}
+	}
+}
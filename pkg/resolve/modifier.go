@@ -1,51 +1,171 @@
 package resolve
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/pmezard/go-difflib/difflib"
 	"go.uber.org/zap"
 	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 
+	"github.com/MovieStoreGuy/versionist/pkg/goproxy"
 	"github.com/MovieStoreGuy/versionist/pkg/internal/filewalk"
+	"github.com/MovieStoreGuy/versionist/pkg/internal/gover"
 	"github.com/MovieStoreGuy/versionist/pkg/manifest"
 )
 
 const (
-	ModFilename = "*go.mod"
-	ModComment  = "Modified by versionist"
+	ModFilename = "go.mod"
+	ModComment  = "// Modified by versionist"
+)
+
+var (
+	ErrNoGoProxyClient = errors.New("forced projects require a goproxy client")
 )
 
 type Modifier struct {
-	bom  *manifest.Manifest
-	root string
-	log  *zap.Logger
+	bom    *manifest.Manifest
+	root   string
+	log    *zap.Logger
+	dryRun io.Writer
+	client goproxy.Client
+	graph  *graph
 }
 
 type ModifierOption func(m *Modifier)
 
+// Drift describes a value within a go.mod
+// that does not match the manifest.
+type Drift struct {
+	// Path is the go.mod file relative to the root
+	Path string
+	// Module is the required module path, "go" and "toolchain"
+	// for the go and toolchain directives, "replace <path>" or "exclude <path>"
+	Module   string
+	Current  string
+	Expected string
+}
+
+// change holds the original and formatted
+// content of a go.mod that needs to be updated.
+type change struct {
+	name     string
+	path     string
+	mode     fs.FileMode
+	original []byte
+	updated  []byte
+	drifts   []Drift
+}
+
 func WithLogger(log *zap.Logger) ModifierOption {
 	return func(m *Modifier) {
 		m.log = log
 	}
 }
 
+// WithDryRun stops the modifier from writing any go.mod files
+// and instead writes a unified diff of each change to out.
+func WithDryRun(out io.Writer) ModifierOption {
+	return func(m *Modifier) {
+		m.dryRun = out
+	}
+}
+
+// WithGoProxyClient sets the client used to read the go.mod files
+// of dependencies when building the module graph, it is required
+// when any project in the manifest is forced.
+func WithGoProxyClient(c goproxy.Client) ModifierOption {
+	return func(m *Modifier) {
+		m.client = c
+	}
+}
+
 func NewModifier(root string, bom *manifest.Manifest, opts ...ModifierOption) Modifier {
 	m := Modifier{root: root, bom: bom, log: zap.NewNop()}
 	for _, opt := range opts {
 		opt(&m)
 	}
+	if m.client != nil {
+		m.graph = newGraph(m.client, m.log)
+	}
 	return m
 }
 
-func (m *Modifier) Update() error {
-	walked, err := filewalk.NewWalkedFS(m.root, ModFilename)
+func (m *Modifier) Update(ctx context.Context) error {
+	changes, err := m.changes(ctx)
 	if err != nil {
 		return err
 	}
-	return walked.Range(func(name string, f *os.File) error {
+	for _, c := range changes {
+		for _, d := range c.drifts {
+			m.log.Info("Updating module",
+				zap.String("path", c.name),
+				zap.String("module", d.Module),
+				zap.String("current", d.Current),
+				zap.String("expected", d.Expected),
+			)
+		}
+		if m.dryRun != nil {
+			if err := m.writeDiff(c); err != nil {
+				return err
+			}
+			continue
+		}
+		m.log.Info("Rewritting go mod file", zap.String("path", c.name))
+		if err := os.WriteFile(c.name, c.updated, c.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check compares every go.mod file under the root with the
+// manifest without modifying them and returns all values that differ.
+func (m *Modifier) Check(ctx context.Context) ([]Drift, error) {
+	changes, err := m.changes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var drifts []Drift
+	for _, c := range changes {
+		drifts = append(drifts, c.drifts...)
+	}
+	return drifts, nil
+}
+
+// changes reads every go.mod file under the root and returns
+// the changes required to match the manifest, ordered by file name.
+func (m *Modifier) changes(ctx context.Context) ([]change, error) {
+	walked, err := filewalk.NewWalkedFS(m.root, ModFilename, m.bom.Ignore...)
+	if err != nil {
+		return nil, err
+	}
+	locals, err := m.localModules(walked)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mu      sync.Mutex
+		changes []change
+	)
+	err = walked.Range(func(name string, f fs.File) error {
 		m.log.Info("Reading go mod file", zap.String("path", name))
 
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
 		content, err := io.ReadAll(f)
 		if err != nil {
 			return err
@@ -56,38 +176,312 @@ func (m *Modifier) Update() error {
 			return err
 		}
 
-		modified := false
-		if mod.Go.Version != m.bom.GoVersion {
-			mod.Go.Version = m.bom.GoVersion
-			modified = true
+		rel, err := filepath.Rel(m.root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		var drifts []Drift
+		// record sets the path of the drifts found by an update
+		record := func(found []Drift, err error) error {
+			for _, d := range found {
+				d.Path = rel
+				drifts = append(drifts, d)
+			}
+			return err
+		}
+		if err := record(m.updateGo(mod)); err != nil {
+			return err
+		}
+		if err := record(m.updateToolchain(name, mod)); err != nil {
+			return err
 		}
 
 		for _, req := range mod.Require {
-			if req.Indirect {
+			p, ok := m.bom.MatchProject(req.Mod.Path)
+			if !ok || req.Mod.Version == p.Version {
+				continue
+			}
+			scope := m.bom.ProjectScope(p)
+			if !scope.Includes(req.Indirect) && !p.Force {
 				continue
 			}
-			if ver, update := m.bom.CheckProject(req.Mod.Path); update {
-				modified = true
-				req.Mod.Version = ver
+			if !semver.IsValid(p.Version) {
+				return fmt.Errorf("%s: %s@%s: %w", rel, req.Mod.Path, p.Version, manifest.ErrUnresolved)
+			}
+			drifts = append(drifts, Drift{Path: rel, Module: req.Mod.Path, Current: req.Mod.Version, Expected: p.Version})
+			if err := mod.AddRequire(req.Mod.Path, p.Version); err != nil {
+				return err
 			}
 		}
 
-		if !modified {
+		if err := record(m.updateLocalReplaces(name, mod, locals)); err != nil {
+			return err
+		}
+		if err := record(m.addForced(ctx, name, mod, locals)); err != nil {
+			return err
+		}
+		if err := record(m.updateReplaces(name, mod)); err != nil {
+			return err
+		}
+		if err := record(m.updateExcludes(name, mod)); err != nil {
+			return err
+		}
+
+		if len(drifts) == 0 {
 			m.log.Info("No modifications", zap.String("path", name))
 			return nil
 		}
-		mod.AddComment(ModComment)
+		addModComment(mod)
+		mod.Cleanup()
 
 		data, err := mod.Format()
 		if err != nil {
 			return err
 		}
 
-		m.log.Info("Rewritting go mod file", zap.String("path", name))
-		if err := f.Truncate(0); err != nil {
+		mu.Lock()
+		changes = append(changes, change{
+			name:     name,
+			path:     rel,
+			mode:     stat.Mode(),
+			original: content,
+			updated:  data,
+			drifts:   drifts,
+		})
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].name < changes[j].name
+	})
+	return changes, nil
+}
+
+// localModules returns the directory, relative to
+// the root, of each module path within the tree.
+func (m *Modifier) localModules(walked *filewalk.WalkedFS) (map[string]string, error) {
+	var (
+		mu     sync.Mutex
+		locals = make(map[string]string)
+	)
+	err := walked.Range(func(name string, f fs.File) error {
+		content, err := io.ReadAll(f)
+		if err != nil {
 			return err
 		}
-		_, err = f.Write(data)
-		return err
+		mod, err := modfile.ParseLax(name, content, nil)
+		if err != nil {
+			return err
+		}
+		if mod.Module == nil {
+			return nil
+		}
+		dir, err := filepath.Rel(m.root, filepath.Dir(name))
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		locals[mod.Module.Mod.Path] = filepath.ToSlash(dir)
+		mu.Unlock()
+		return nil
+	})
+	return locals, err
+}
+
+// addForced adds each forced project that is missing from the module
+// as an indirect requirement when the module transitively depends on it.
+func (m *Modifier) addForced(ctx context.Context, name string, mod *modfile.File, locals map[string]string) ([]Drift, error) {
+	required := make(map[string]struct{}, len(mod.Require))
+	for _, r := range mod.Require {
+		required[r.Mod.Path] = struct{}{}
+	}
+	targets := make(map[string]struct{})
+	for _, p := range m.bom.Projects {
+		if _, ok := required[p.Package]; p.Force && !ok {
+			targets[p.Package] = struct{}{}
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	if m.graph == nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrNoGoProxyClient)
+	}
+	dirs := make(map[string]string, len(locals))
+	for path, dir := range locals {
+		dirs[path] = filepath.Join(m.root, filepath.FromSlash(dir))
+	}
+	found, err := m.graph.reaches(ctx, name, mod, dirs, targets)
+	if err != nil {
+		return nil, fmt.Errorf("%s: module graph: %w", name, err)
+	}
+	var drifts []Drift
+	for _, p := range m.bom.Projects {
+		if _, ok := targets[p.Package]; !ok || !found[p.Package] {
+			continue
+		}
+		if !semver.IsValid(p.Version) {
+			return nil, fmt.Errorf("%s: %s@%s: %w", name, p.Package, p.Version, manifest.ErrUnresolved)
+		}
+		mod.AddNewRequire(p.Package, p.Version, true)
+		drifts = append(drifts, Drift{Module: p.Package, Expected: p.Version})
+		delete(targets, p.Package)
+	}
+	return drifts, nil
+}
+
+// updateExcludes makes the excludes of each package within the manifest match
+// its excluded versions, adding any that are missing and dropping the rest.
+func (m *Modifier) updateExcludes(name string, mod *modfile.File) ([]Drift, error) {
+	var (
+		expected = make(map[module.Version]struct{})
+		managed  = make(map[string]struct{}, len(m.bom.Exclude))
+	)
+	for _, e := range m.bom.Exclude {
+		managed[e.Package] = struct{}{}
+		for _, v := range e.Versions {
+			expected[module.Version{Path: e.Package, Version: v}] = struct{}{}
+		}
+	}
+
+	var (
+		drifts   []Drift
+		excluded = make(map[module.Version]struct{}, len(mod.Exclude))
+		stale    []module.Version
+	)
+	for _, x := range mod.Exclude {
+		excluded[x.Mod] = struct{}{}
+		if _, ok := managed[x.Mod.Path]; !ok {
+			continue
+		}
+		if _, ok := expected[x.Mod]; !ok {
+			stale = append(stale, x.Mod)
+		}
+	}
+	for _, x := range stale {
+		if err := mod.DropExclude(x.Path, x.Version); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		drifts = append(drifts, Drift{Module: "exclude " + x.Path, Current: x.Version})
+	}
+
+	for _, e := range m.bom.Exclude {
+		for _, v := range e.Versions {
+			if _, ok := excluded[module.Version{Path: e.Package, Version: v}]; ok {
+				continue
+			}
+			if err := mod.AddExclude(e.Package, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			drifts = append(drifts, Drift{Module: "exclude " + e.Package, Expected: v})
+		}
+	}
+	return drifts, nil
+}
+
+// updateGo sets the go directive to match the manifest, in minimum
+// mode a module requiring a newer go version is left unchanged.
+func (m *Modifier) updateGo(mod *modfile.File) ([]Drift, error) {
+	current := ""
+	if mod.Go != nil {
+		current = mod.Go.Version
+	}
+	switch {
+	case current == m.bom.GoVersion:
+		return nil, nil
+	case m.bom.GoVersionMode == manifest.GoVersionMinimum && current != "" && gover.Compare(current, m.bom.GoVersion) > 0:
+		return nil, nil
+	}
+	if err := mod.AddGoStmt(m.bom.GoVersion); err != nil {
+		return nil, err
+	}
+	return []Drift{{Module: "go", Current: current, Expected: m.bom.GoVersion}}, nil
+}
+
+// updateToolchain sets or removes the toolchain directive to match the manifest,
+// modules older than go 1.21 are skipped as they do not support the directive.
+// A toolchain older than the module's go version is not set as it would be ignored.
+func (m *Modifier) updateToolchain(name string, mod *modfile.File) ([]Drift, error) {
+	if mod.Go == nil || gover.Compare(mod.Go.Version, manifest.ToolchainGoVersion) < 0 {
+		return nil, nil
+	}
+	current := ""
+	if mod.Toolchain != nil {
+		current = mod.Toolchain.Name
+	}
+	expected := m.bom.Toolchain
+	if expected == "go"+mod.Go.Version {
+		// `go mod tidy` removes a toolchain that matches the go version
+		expected = manifest.ToolchainNone
+	}
+	switch expected {
+	case "":
+		return nil, nil
+	case manifest.ToolchainNone:
+		if current == "" {
+			return nil, nil
+		}
+		mod.DropToolchainStmt()
+		return []Drift{{Module: "toolchain", Current: current}}, nil
+	case current:
+		return nil, nil
+	}
+	if gover.Compare(strings.TrimPrefix(expected, "go"), mod.Go.Version) < 0 {
+		m.log.Warn("Toolchain is older than the module's go version, not updating",
+			zap.String("path", name),
+			zap.String("toolchain", expected),
+			zap.String("go", mod.Go.Version),
+		)
+		return nil, nil
+	}
+	if err := mod.AddToolchainStmt(expected); err != nil {
+		return nil, err
+	}
+	return []Drift{{Module: "toolchain", Current: current, Expected: expected}}, nil
+}
+
+func (m *Modifier) writeDiff(c change) error {
+	return difflib.WriteUnifiedDiff(m.dryRun, difflib.UnifiedDiff{
+		A:        splitLines(c.original),
+		B:        splitLines(c.updated),
+		FromFile: "a/" + c.path,
+		ToFile:   "b/" + c.path,
+		Context:  3,
 	})
 }
+
+// splitLines breaks content into lines while keeping
+// the line endings as expected by difflib.
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func addModComment(mod *modfile.File) {
+	for _, stmt := range mod.Syntax.Stmt {
+		for _, c := range stmt.Comment().Before {
+			if c.Token == ModComment {
+				return
+			}
+		}
+	}
+	mod.AddComment(ModComment)
+}
+
+func (d Drift) String() string {
+	if d.Expected == "" {
+		return fmt.Sprintf("%s: %s is %s, expected it to be removed", d.Path, d.Module, d.Current)
+	}
+	if d.Current == "" {
+		return fmt.Sprintf("%s: %s is missing, expected %s", d.Path, d.Module, d.Expected)
+	}
+	return fmt.Sprintf("%s: %s is %s, expected %s", d.Path, d.Module, d.Current, d.Expected)
+}
@@ -1 +1,593 @@
 package resolve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/mod/modfile"
+
+	"github.com/MovieStoreGuy/versionist/pkg/goproxy"
+	"github.com/MovieStoreGuy/versionist/pkg/manifest"
+)
+
+func writeModules(t *testing.T, root string, modules map[string]string) {
+	t.Helper()
+	for name, content := range modules {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755), "Must create module directory")
+		require.NoError(t, os.WriteFile(name, []byte(content), 0o644), "Must write module file")
+	}
+}
+
+func readModule(t *testing.T, root, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+	require.NoError(t, err, "Must read module file")
+	return string(content)
+}
+
+func readManifest(t *testing.T, root, content string) *manifest.Manifest {
+	t.Helper()
+	name := filepath.Join(root, "versionist.yml")
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o644), "Must write manifest")
+	m, err := manifest.ReadManifest(context.Background(), name)
+	require.NoError(t, err, "Must read manifest")
+	return m
+}
+
+func TestModifierUpdate(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":                         "module github.com/awesome/package\n\ngo 1.18\n\nrequire go.uber.org/zap v1.21.0\n",
+		"components/foo/go.mod":          "module github.com/awesome/package/components/foo\n\ngo 1.18\n\nrequire (\n\tgo.uber.org/zap v1.20.0\n\tgo.uber.org/atomic v1.7.0 // indirect\n)\n",
+		"vendor/github.com/other/go.mod": "module github.com/other\n\ngo 1.12\n",
+	})
+
+	m := readManifest(t, root, "go_version: 1.19\nprojects:\n- package: go.uber.org/zap\n  version: v1.23.0\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\nrequire go.uber.org/zap v1.23.0\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must update the root module",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/foo\n\ngo 1.19\n\nrequire (\n\tgo.uber.org/zap v1.23.0\n\tgo.uber.org/atomic v1.7.0 // indirect\n)\n\n// Modified by versionist\n",
+		readModule(t, root, "components/foo/go.mod"),
+		"Must update the nested module",
+	)
+	assert.Equal(t,
+		"module github.com/other\n\ngo 1.12\n",
+		readModule(t, root, "vendor/github.com/other/go.mod"),
+		"Must not modify vendored modules",
+	)
+}
+
+func TestModifierDryRun(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	original := "module github.com/awesome/package\n\ngo 1.18\n\nrequire go.uber.org/zap v1.21.0\n"
+	writeModules(t, root, map[string]string{
+		"go.mod": original,
+	})
+
+	m := readManifest(t, root, "go_version: 1.19\nprojects:\n- package: go.uber.org/zap\n  version: v1.23.0\n")
+
+	var out bytes.Buffer
+	modifier := NewModifier(root, m,
+		WithLogger(zaptest.NewLogger(t)),
+		WithDryRun(&out),
+	)
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t, original, readModule(t, root, "go.mod"), "Must not modify the module")
+	assert.Equal(t, `--- a/go.mod
++++ b/go.mod
+@@ -1,5 +1,7 @@
+ module github.com/awesome/package
+ 
+-go 1.18
++go 1.19
+ 
+-require go.uber.org/zap v1.21.0
++require go.uber.org/zap v1.23.0
++
++// Modified by versionist
+`, out.String(), "Must print the unified diff")
+}
+
+func TestModifierCheck(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	modules := map[string]string{
+		"go.mod":                "module github.com/awesome/package\n\ngo 1.19\n\nrequire go.uber.org/zap v1.23.0\n",
+		"components/foo/go.mod": "module github.com/awesome/package/components/foo\n\ngo 1.18\n\nrequire go.uber.org/zap v1.20.0\n",
+	}
+	writeModules(t, root, modules)
+
+	m := readManifest(t, root, "go_version: 1.19\nprojects:\n- package: go.uber.org/zap\n  version: v1.23.0\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	drifts, err := modifier.Check(context.Background())
+	require.NoError(t, err, "Must not error when checking modules")
+	assert.Equal(t, []Drift{
+		{Path: "components/foo/go.mod", Module: "go", Current: "1.18", Expected: "1.19"},
+		{Path: "components/foo/go.mod", Module: "go.uber.org/zap", Current: "v1.20.0", Expected: "v1.23.0"},
+	}, drifts, "Must report every drifted value")
+
+	for name, content := range modules {
+		assert.Equal(t, content, readModule(t, root, name), "Must not modify the module")
+	}
+}
+
+func TestModifierUnresolvedVersion(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	original := "module github.com/awesome/package\n\ngo 1.19\n\nrequire go.uber.org/zap v1.21.0\n"
+	writeModules(t, root, map[string]string{
+		"go.mod": original,
+	})
+
+	m := &manifest.Manifest{
+		GoVersion: "1.19",
+		Projects: []*manifest.Project{
+			{Package: "go.uber.org/zap", Version: "latest", Match: []manifest.Matcher{regexp.MustCompile("^go.uber.org/zap$")}},
+		},
+	}
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	assert.ErrorIs(t, modifier.Update(context.Background()), manifest.ErrUnresolved, "Must refuse to write an unresolved version")
+	assert.Equal(t, original, readModule(t, root, "go.mod"), "Must not modify the module")
+}
+
+func TestModifierToolchain(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		scenario  string
+		toolchain string
+		original  string
+		expect    string
+	}{
+		{
+			scenario:  "adds toolchain",
+			toolchain: "go1.21.3",
+			original:  "module github.com/awesome/package\n\ngo 1.21\n",
+			expect:    "module github.com/awesome/package\n\ngo 1.21\n\ntoolchain go1.21.3\n\n// Modified by versionist\n",
+		},
+		{
+			scenario:  "updates toolchain",
+			toolchain: "1.21.3",
+			original:  "module github.com/awesome/package\n\ngo 1.21\n\ntoolchain go1.21.0\n",
+			expect:    "module github.com/awesome/package\n\ngo 1.21\n\ntoolchain go1.21.3\n\n// Modified by versionist\n",
+		},
+		{
+			scenario:  "removes toolchain",
+			toolchain: "none",
+			original:  "module github.com/awesome/package\n\ngo 1.21\n\ntoolchain go1.21.0\n",
+			expect:    "module github.com/awesome/package\n\ngo 1.21\n\n// Modified by versionist\n",
+		},
+		{
+			scenario:  "toolchain matching the go version",
+			toolchain: "go1.21",
+			original:  "module github.com/awesome/package\n\ngo 1.21\n",
+			expect:    "module github.com/awesome/package\n\ngo 1.21\n",
+		},
+		{
+			scenario:  "removes toolchain matching the go version",
+			toolchain: "go1.21",
+			original:  "module github.com/awesome/package\n\ngo 1.21\n\ntoolchain go1.21.0\n",
+			expect:    "module github.com/awesome/package\n\ngo 1.21\n\n// Modified by versionist\n",
+		},
+		{
+			scenario:  "unmanaged toolchain",
+			toolchain: "",
+			original:  "module github.com/awesome/package\n\ngo 1.21\n\ntoolchain go1.21.0\n",
+			expect:    "module github.com/awesome/package\n\ngo 1.21\n\ntoolchain go1.21.0\n",
+		},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			writeModules(t, root, map[string]string{
+				"go.mod": tc.original,
+			})
+
+			m := readManifest(t, root, "go_version: 1.21\ntoolchain: \""+tc.toolchain+"\"\n")
+
+			modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+			require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+			assert.Equal(t, tc.expect, readModule(t, root, "go.mod"), "Must match the expected module")
+		})
+	}
+}
+
+func TestModifierMinimumGoVersion(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":                "module github.com/awesome/package\n\ngo 1.18\n",
+		"components/foo/go.mod": "module github.com/awesome/package/components/foo\n\ngo 1.21\n",
+	})
+
+	m := readManifest(t, root, "go_version: 1.19\ngo_version_mode: minimum\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must raise an older go version",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/foo\n\ngo 1.21\n",
+		readModule(t, root, "components/foo/go.mod"),
+		"Must not lower a newer go version",
+	)
+}
+
+func TestModifierScope(t *testing.T) {
+	t.Parallel()
+
+	const original = "module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgo.uber.org/zap v1.21.0\n\tgoogle.golang.org/grpc v1.50.0 // indirect\n)\n"
+
+	for _, tc := range []struct {
+		scenario string
+		manifest string
+		expect   string
+	}{
+		{
+			scenario: "default scope skips indirect",
+			manifest: "go_version: 1.19\nprojects:\n- package: google.golang.org/grpc\n  version: v1.56.3\n",
+			expect:   original,
+		},
+		{
+			scenario: "indirect scope",
+			manifest: "go_version: 1.19\nprojects:\n- package: google.golang.org/grpc\n  version: v1.56.3\n  scope: indirect\n- package: go.uber.org/zap\n  version: v1.23.0\n  scope: indirect\n",
+			expect:   "module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgo.uber.org/zap v1.21.0\n\tgoogle.golang.org/grpc v1.56.3 // indirect\n)\n\n// Modified by versionist\n",
+		},
+		{
+			scenario: "global all scope",
+			manifest: "go_version: 1.19\nscope: all\nprojects:\n- package: google.golang.org/grpc\n  version: v1.56.3\n- package: go.uber.org/zap\n  version: v1.23.0\n",
+			expect:   "module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgo.uber.org/zap v1.23.0\n\tgoogle.golang.org/grpc v1.56.3 // indirect\n)\n\n// Modified by versionist\n",
+		},
+		{
+			scenario: "project overrides global scope",
+			manifest: "go_version: 1.19\nscope: all\nprojects:\n- package: google.golang.org/grpc\n  version: v1.56.3\n  scope: direct\n",
+			expect:   original,
+		},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			writeModules(t, root, map[string]string{
+				"go.mod": original,
+			})
+
+			m := readManifest(t, root, tc.manifest)
+
+			modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+			require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+			assert.Equal(t, tc.expect, readModule(t, root, "go.mod"), "Must match the expected module")
+		})
+	}
+}
+
+type mockGoproxy struct {
+	goproxy.Client
+
+	mods map[string]string
+}
+
+func (mg mockGoproxy) Mod(_ context.Context, module, version string) (*modfile.File, error) {
+	content, ok := mg.mods[module+"@"+version]
+	if !ok {
+		return nil, fmt.Errorf("%s@%s: %w", module, version, os.ErrNotExist)
+	}
+	return modfile.ParseLax("go.mod", []byte(content), nil)
+}
+
+func TestModifierForce(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":                "module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/a v1.0.0\n",
+		"components/foo/go.mod": "module github.com/awesome/package/components/foo\n\ngo 1.19\n\nrequire github.com/awesome/c v1.0.0\n",
+		"components/bar/go.mod": "module github.com/awesome/package/components/bar\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/a v1.0.0\n\tgithub.com/awesome/vulnerable v1.0.0 // indirect\n)\n",
+	})
+
+	client := mockGoproxy{mods: map[string]string{
+		"github.com/awesome/a@v1.0.0":          "module github.com/awesome/a\n\nrequire github.com/awesome/b v1.0.0\n",
+		"github.com/awesome/b@v1.0.0":          "module github.com/awesome/b\n\nrequire github.com/awesome/vulnerable v1.0.0\n",
+		"github.com/awesome/c@v1.0.0":          "module github.com/awesome/c\n",
+		"github.com/awesome/vulnerable@v1.0.0": "module github.com/awesome/vulnerable\n",
+	}}
+
+	m := readManifest(t, root, "go_version: 1.19\nprojects:\n- package: github.com/awesome/vulnerable\n  version: v1.2.0\n  force: true\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)), WithGoProxyClient(client))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/a v1.0.0\n\tgithub.com/awesome/vulnerable v1.2.0 // indirect\n)\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must add the transitive requirement",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/foo\n\ngo 1.19\n\nrequire github.com/awesome/c v1.0.0\n",
+		readModule(t, root, "components/foo/go.mod"),
+		"Must not add the requirement to modules that do not depend on it",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/bar\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/a v1.0.0\n\tgithub.com/awesome/vulnerable v1.2.0 // indirect\n)\n\n// Modified by versionist\n",
+		readModule(t, root, "components/bar/go.mod"),
+		"Must update the existing indirect requirement",
+	)
+}
+
+func TestModifierForceLocalModules(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":     "module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/package/lib v0.0.0\n\nreplace github.com/awesome/package/lib => ./lib\n",
+		"lib/go.mod": "module github.com/awesome/package/lib\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/package/tools v0.0.0\n\tgithub.com/awesome/vulnerable v1.0.0\n)\n",
+		"svc/go.mod": "module github.com/awesome/package/svc\n\ngo 1.19\n\nrequire github.com/awesome/package/lib v0.0.0\n",
+	})
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "tools"), 0o755), "Must create the package directory")
+
+	client := mockGoproxy{mods: map[string]string{
+		"github.com/awesome/vulnerable@v1.0.0": "module github.com/awesome/vulnerable\n",
+	}}
+
+	m := readManifest(t, root, "go_version: 1.19\nprojects:\n- package: github.com/awesome/vulnerable\n  version: v1.2.0\n  force: true\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)), WithGoProxyClient(client))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/package/lib v0.0.0\n\tgithub.com/awesome/vulnerable v1.2.0 // indirect\n)\n\nreplace github.com/awesome/package/lib => ./lib\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must follow the directory replacement",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/svc\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/package/lib v0.0.0\n\tgithub.com/awesome/vulnerable v1.2.0 // indirect\n)\n\n// Modified by versionist\n",
+		readModule(t, root, "svc/go.mod"),
+		"Must read modules within the tree from disk",
+	)
+
+	drifts, err := modifier.Check(context.Background())
+	require.NoError(t, err, "Must not error when checking modules")
+	assert.Empty(t, drifts, "Must not drift once updated")
+}
+
+func TestModifierForceUnreadableModule(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod": "module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/private v1.0.0\n",
+	})
+
+	m := readManifest(t, root, "go_version: 1.19\nprojects:\n- package: github.com/awesome/vulnerable\n  version: v1.2.0\n  force: true\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)), WithGoProxyClient(mockGoproxy{}))
+	_, err := modifier.Check(context.Background())
+	assert.ErrorIs(t, err, os.ErrNotExist, "Must error when a module's requirements can not be read")
+}
+
+func TestModifierForceWithoutClient(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod": "module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/a v1.0.0\n",
+	})
+
+	m := readManifest(t, root, "go_version: 1.19\nprojects:\n- package: github.com/awesome/vulnerable\n  version: v1.2.0\n  force: true\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	_, err := modifier.Check(context.Background())
+	assert.ErrorIs(t, err, ErrNoGoProxyClient, "Must error when forcing projects without a client")
+}
+
+func TestModifierReplace(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":                "module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/old v1.0.0\n\tgithub.com/awesome/other v1.0.0\n)\n\nreplace github.com/awesome/removed => ../removed\n",
+		"components/foo/go.mod": "module github.com/awesome/package/components/foo\n\ngo 1.19\n\nrequire github.com/awesome/old v1.0.0\n\nreplace github.com/awesome/old => github.com/awesome/old v0.9.0\n",
+		"components/bar/go.mod": "module github.com/awesome/package/components/bar\n\ngo 1.19\n\nrequire github.com/awesome/unrelated v1.0.0\n",
+	})
+
+	m := readManifest(t, root, `go_version: 1.19
+replace:
+- old: github.com/awesome/old
+  new: ./forks/old
+- old: github.com/awesome/other@v1.0.0
+  new: github.com/fork/other@v1.1.0
+- old: github.com/awesome/removed
+`)
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/old v1.0.0\n\tgithub.com/awesome/other v1.0.0\n)\n\nreplace github.com/awesome/old => ./forks/old\n\nreplace github.com/awesome/other v1.0.0 => github.com/fork/other v1.1.0\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must add and remove replacements",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/foo\n\ngo 1.19\n\nrequire github.com/awesome/old v1.0.0\n\nreplace github.com/awesome/old => ../../forks/old\n\n// Modified by versionist\n",
+		readModule(t, root, "components/foo/go.mod"),
+		"Must update the replacement relative to the module",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/bar\n\ngo 1.19\n\nrequire github.com/awesome/unrelated v1.0.0\n",
+		readModule(t, root, "components/bar/go.mod"),
+		"Must not add replacements to modules that do not require them",
+	)
+
+	drifts, err := modifier.Check(context.Background())
+	require.NoError(t, err, "Must not error when checking modules")
+	assert.Empty(t, drifts, "Must not drift once updated")
+}
+
+func TestModifierReplaceVersions(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod": "module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/old v1.1.0\n\nreplace github.com/awesome/old v1.0.0 => github.com/fork/old v1.0.0\n",
+	})
+
+	m := readManifest(t, root, `go_version: 1.19
+replace:
+- old: github.com/awesome/old@v1.0.0
+  new: github.com/fork/old@v1.0.1
+- old: github.com/awesome/old@v1.1.0
+  new: github.com/fork/old@v1.1.1
+- old: github.com/awesome/old
+  new: ./forks/old
+`)
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/old v1.1.0\n\nreplace (\n\tgithub.com/awesome/old => ./forks/old\n\tgithub.com/awesome/old v1.0.0 => github.com/fork/old v1.0.1\n\tgithub.com/awesome/old v1.1.0 => github.com/fork/old v1.1.1\n)\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must replace each version separately",
+	)
+
+	drifts, err := modifier.Check(context.Background())
+	require.NoError(t, err, "Must not error when checking modules")
+	assert.Empty(t, drifts, "Must not drift once updated")
+}
+
+func TestModifierLocalReplaces(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":                "module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/package/components/foo v0.0.0\n\nreplace (\n\tgithub.com/awesome/package/components/gone => ./components/gone\n\tgithub.com/awesome/elsewhere => ../elsewhere\n)\n",
+		"components/foo/go.mod": "module github.com/awesome/package/components/foo\n\ngo 1.19\n",
+		"components/bar/go.mod": "module github.com/awesome/package/components/bar\n\ngo 1.19\n\nrequire github.com/awesome/package/components/foo v0.0.0\n\nreplace github.com/awesome/package/components/foo => ../../components/foo\n",
+	})
+
+	m := readManifest(t, root, "go_version: 1.19\nlocal_replaces: true\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\nrequire github.com/awesome/package/components/foo v0.0.0\n\nreplace github.com/awesome/elsewhere => ../elsewhere\n\nreplace github.com/awesome/package/components/foo => ./components/foo\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must add local replacements and remove stale ones",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/bar\n\ngo 1.19\n\nrequire github.com/awesome/package/components/foo v0.0.0\n\nreplace github.com/awesome/package/components/foo => ../foo\n\n// Modified by versionist\n",
+		readModule(t, root, "components/bar/go.mod"),
+		"Must replace with the directory relative to the module",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/foo\n\ngo 1.19\n",
+		readModule(t, root, "components/foo/go.mod"),
+		"Must not modify modules without local requirements",
+	)
+
+	drifts, err := modifier.Check(context.Background())
+	require.NoError(t, err, "Must not error when checking modules")
+	assert.Empty(t, drifts, "Must not drift once updated")
+}
+
+func TestModifierLocalReplacesWithReplace(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":             "module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/old v1.0.0\n\tgithub.com/awesome/other v1.0.0\n)\n",
+		"forks/other/go.mod": "module github.com/fork/other\n\ngo 1.19\n",
+	})
+
+	m := readManifest(t, root, `go_version: 1.19
+local_replaces: true
+replace:
+- old: github.com/awesome/old
+  new: ./forks/old
+- old: github.com/awesome/other
+  new: ./forks/other
+`)
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	expect := "module github.com/awesome/package\n\ngo 1.19\n\nrequire (\n\tgithub.com/awesome/old v1.0.0\n\tgithub.com/awesome/other v1.0.0\n)\n\nreplace github.com/awesome/old => ./forks/old\n\nreplace github.com/awesome/other => ./forks/other\n\n// Modified by versionist\n"
+	assert.Equal(t, expect, readModule(t, root, "go.mod"), "Must keep the manifest replacements")
+
+	drifts, err := modifier.Check(context.Background())
+	require.NoError(t, err, "Must not error when checking modules")
+	assert.Empty(t, drifts, "Must not drift once updated")
+
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+	assert.Equal(t, expect, readModule(t, root, "go.mod"), "Must not change the module once updated")
+}
+
+func TestModifierExclude(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeModules(t, root, map[string]string{
+		"go.mod":                "module github.com/awesome/package\n\ngo 1.19\n\nrequire go.uber.org/zap v1.21.0\n",
+		"components/foo/go.mod": "module github.com/awesome/package/components/foo\n\ngo 1.19\n\nexclude go.uber.org/zap v1.23.1\n",
+		"components/bar/go.mod": "module github.com/awesome/package/components/bar\n\ngo 1.19\n\nexclude (\n\tgithub.com/awesome/removed v1.0.0\n\tgithub.com/awesome/unmanaged v1.0.0\n\tgo.uber.org/zap v1.23.0\n\tgo.uber.org/zap v1.23.1\n)\n",
+	})
+
+	m := readManifest(t, root, "go_version: 1.19\nexclude:\n- package: go.uber.org/zap\n  version: v1.23.1\n- package: github.com/awesome/removed\n")
+
+	modifier := NewModifier(root, m, WithLogger(zaptest.NewLogger(t)))
+	require.NoError(t, modifier.Update(context.Background()), "Must not error when updating modules")
+
+	assert.Equal(t,
+		"module github.com/awesome/package\n\ngo 1.19\n\nrequire go.uber.org/zap v1.21.0\n\nexclude go.uber.org/zap v1.23.1\n\n// Modified by versionist\n",
+		readModule(t, root, "go.mod"),
+		"Must add the exclude",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/foo\n\ngo 1.19\n\nexclude go.uber.org/zap v1.23.1\n",
+		readModule(t, root, "components/foo/go.mod"),
+		"Must not duplicate an existing exclude",
+	)
+	assert.Equal(t,
+		"module github.com/awesome/package/components/bar\n\ngo 1.19\n\nexclude (\n\tgithub.com/awesome/unmanaged v1.0.0\n\tgo.uber.org/zap v1.23.1\n)\n\n// Modified by versionist\n",
+		readModule(t, root, "components/bar/go.mod"),
+		"Must remove excludes that are no longer in the manifest",
+	)
+
+	drifts, err := modifier.Check(context.Background())
+	require.NoError(t, err, "Must not error when checking modules")
+	assert.Empty(t, drifts, "Must not drift once updated")
+}
@@ -0,0 +1,224 @@
+package resolve
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+
+	"github.com/MovieStoreGuy/versionist/pkg/manifest"
+)
+
+// updateReplaces applies the manifest's replace directives to the module
+// at name, only modules that require or already replace the old module are
+// changed and local directories are made relative to the module. Existing
+// replacements are matched by their old path and version, so an unversioned
+// replacement does not change those of a single version.
+func (m *Modifier) updateReplaces(name string, mod *modfile.File) ([]Drift, error) {
+	required := make(map[string]struct{}, len(mod.Require))
+	for _, r := range mod.Require {
+		required[r.Mod.Path] = struct{}{}
+	}
+
+	var drifts []Drift
+	for _, r := range m.bom.Replace {
+		var existing *modfile.Replace
+		for _, mr := range mod.Replace {
+			if mr.Old == r.Old {
+				existing = mr
+				break
+			}
+		}
+
+		if r.Remove() {
+			if existing == nil {
+				continue
+			}
+			drifts = append(drifts, Drift{Module: replaceName(existing.Old), Current: formatVersion(existing.New)})
+			if err := mod.DropReplace(existing.Old.Path, existing.Old.Version); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, ok := required[r.Old.Path]; !ok && existing == nil {
+			continue
+		}
+		if mod.Module != nil && mod.Module.Mod.Path == r.Old.Path {
+			continue
+		}
+
+		target, err := m.replaceTarget(name, r)
+		if err != nil {
+			return nil, err
+		}
+		current := ""
+		if existing != nil {
+			if existing.New == target {
+				continue
+			}
+			current = formatVersion(existing.New)
+		}
+		if err := addReplace(mod, r.Old, target); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, Drift{Module: replaceName(r.Old), Current: current, Expected: formatVersion(target)})
+	}
+	return drifts, nil
+}
+
+// addReplace sets the replacement of old, keeping the replacements of single versions
+// of the module that AddReplace would otherwise overwrite for an unversioned old.
+func addReplace(mod *modfile.File, old, target module.Version) error {
+	var versioned []modfile.Replace
+	if old.Version == "" {
+		for _, mr := range mod.Replace {
+			if mr.Old.Path == old.Path && mr.Old.Version != "" {
+				versioned = append(versioned, *mr)
+			}
+		}
+	}
+	for _, mr := range versioned {
+		if err := mod.DropReplace(mr.Old.Path, mr.Old.Version); err != nil {
+			return err
+		}
+	}
+	if err := mod.AddReplace(old.Path, old.Version, target.Path, target.Version); err != nil {
+		return err
+	}
+	for _, mr := range versioned {
+		if err := mod.AddReplace(mr.Old.Path, mr.Old.Version, mr.New.Path, mr.New.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateLocalReplaces replaces each requirement on a module within the tree
+// with its directory, and removes replacements of modules that point within
+// the tree to a directory that is no longer the module. Modules replaced by
+// the manifest are left to updateReplaces.
+func (m *Modifier) updateLocalReplaces(name string, mod *modfile.File, locals map[string]string) ([]Drift, error) {
+	if !m.bom.LocalReplaces {
+		return nil, nil
+	}
+	var drifts []Drift
+	for _, r := range mod.Require {
+		dir, ok := locals[r.Mod.Path]
+		if !ok || m.managedReplace(r.Mod.Path) || (mod.Module != nil && mod.Module.Mod.Path == r.Mod.Path) {
+			continue
+		}
+		target, err := m.relativeDir(name, dir)
+		if err != nil {
+			return nil, err
+		}
+		var existing []*modfile.Replace
+		for _, mr := range mod.Replace {
+			if mr.Old.Path == r.Mod.Path {
+				existing = append(existing, mr)
+			}
+		}
+		if len(existing) == 1 && existing[0].Old.Version == "" && existing[0].New == (module.Version{Path: target}) {
+			continue
+		}
+		current := ""
+		for _, mr := range existing {
+			if current == "" {
+				current = formatVersion(mr.New)
+			}
+			if err := mod.DropReplace(mr.Old.Path, mr.Old.Version); err != nil {
+				return nil, err
+			}
+		}
+		if err := mod.AddReplace(r.Mod.Path, "", target, ""); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, Drift{Module: replaceName(module.Version{Path: r.Mod.Path}), Current: current, Expected: target})
+	}
+
+	for _, mr := range mod.Replace {
+		if mr.Old.Path == "" || m.managedReplace(mr.Old.Path) || mr.New.Version != "" || !modfile.IsDirectoryPath(mr.New.Path) || path.IsAbs(mr.New.Path) {
+			continue
+		}
+		target := filepath.Join(filepath.Dir(name), filepath.FromSlash(mr.New.Path))
+		dir, err := filepath.Rel(m.root, target)
+		if err != nil {
+			return nil, err
+		}
+		if dir = filepath.ToSlash(dir); dir == ".." || strings.HasPrefix(dir, "../") {
+			// Replacements outside of the tree are not managed
+			continue
+		}
+		if localModulePath(target) == mr.Old.Path {
+			continue
+		}
+		drifts = append(drifts, Drift{Module: replaceName(mr.Old), Current: formatVersion(mr.New)})
+		if err := mod.DropReplace(mr.Old.Path, mr.Old.Version); err != nil {
+			return nil, err
+		}
+	}
+	return drifts, nil
+}
+
+// managedReplace reports if the manifest has a replace directive for the module path.
+func (m *Modifier) managedReplace(path string) bool {
+	for _, r := range m.bom.Replace {
+		if r.Old.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// localModulePath returns the module path of the go.mod within
+// dir, or an empty string when there is no module.
+func localModulePath(dir string) string {
+	content, err := os.ReadFile(filepath.Join(dir, ModFilename))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(content)
+}
+
+// replaceTarget returns the replacement as used within the module at name,
+// local directories are converted from relative to the root to relative to the module.
+func (m *Modifier) replaceTarget(name string, r *manifest.Replace) (module.Version, error) {
+	if !r.Local() {
+		return r.New, nil
+	}
+	dir, err := m.relativeDir(name, r.New.Path)
+	if err != nil {
+		return module.Version{}, err
+	}
+	return module.Version{Path: dir}, nil
+}
+
+// relativeDir returns the directory, relative to the root,
+// as a go.mod directory path relative to the module at name.
+func (m *Modifier) relativeDir(name, dir string) (string, error) {
+	rel, err := filepath.Rel(filepath.Dir(name), filepath.Join(m.root, filepath.FromSlash(dir)))
+	if err != nil {
+		return "", err
+	}
+	switch rel = filepath.ToSlash(rel); {
+	case rel == ".":
+		return "./", nil
+	case rel == "..", strings.HasPrefix(rel, "../"):
+		return rel, nil
+	}
+	return "./" + rel, nil
+}
+
+func replaceName(old module.Version) string {
+	return "replace " + formatVersion(old)
+}
+
+func formatVersion(mv module.Version) string {
+	if mv.Version == "" {
+		return mv.Path
+	}
+	return mv.Path + " " + mv.Version
+}
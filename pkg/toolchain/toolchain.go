@@ -0,0 +1,157 @@
+// Package toolchain resolves Go toolchain releases from the
+// go.dev download listing, or a local copy of it, so the
+// `toolchain` directive can follow the latest stable release.
+package toolchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/MovieStoreGuy/versionist/pkg/internal/gover"
+	"github.com/MovieStoreGuy/versionist/pkg/request"
+)
+
+// DefaultListing is the go.dev download listing of the current releases.
+const DefaultListing = "https://go.dev/dl/?mode=json"
+
+var (
+	ErrNoStableRelease = errors.New("no stable release")
+	ErrOffline         = errors.New("listing requires the network while offline, use a local file")
+)
+
+type (
+	// Resolver finds the toolchain to use for the `latest` keyword.
+	Resolver interface {
+		// Latest returns the newest stable toolchain name, ie `go1.21.3`.
+		Latest(ctx context.Context) (name string, err error)
+	}
+
+	ResolverOption func(l *listing)
+
+	// Release is an entry within the download listing.
+	Release struct {
+		Version string `json:"version"`
+		Stable  bool   `json:"stable"`
+	}
+
+	listing struct {
+		log     *zap.Logger
+		net     *http.Client
+		retry   request.RetryPolicy
+		source  string
+		offline bool
+	}
+)
+
+var (
+	_ Resolver = (*listing)(nil)
+)
+
+// WithListingSource reads the listing from the source instead of go.dev,
+// the source can be a http(s) URL, a `file://` URL or a local path
+// to a file containing the same JSON document.
+func WithListingSource(source string) ResolverOption {
+	return func(l *listing) {
+		l.source = source
+	}
+}
+
+func WithHTTPClient(c *http.Client) ResolverOption {
+	return func(l *listing) {
+		l.net = c
+	}
+}
+
+func WithLogger(log *zap.Logger) ResolverOption {
+	return func(l *listing) {
+		l.log = log
+	}
+}
+
+// WithRetryPolicy configures how failed requests of a listing URL are retried.
+func WithRetryPolicy(policy request.RetryPolicy) ResolverOption {
+	return func(l *listing) {
+		l.retry = policy
+	}
+}
+
+// WithOffline rejects listing sources that are read over
+// the network so only local files can be used.
+func WithOffline(offline bool) ResolverOption {
+	return func(l *listing) {
+		l.offline = offline
+	}
+}
+
+func NewResolver(opts ...ResolverOption) Resolver {
+	l := &listing{
+		log:    zap.NewNop(),
+		net:    http.DefaultClient,
+		retry:  request.DefaultRetryPolicy(),
+		source: DefaultListing,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func (l *listing) Latest(ctx context.Context) (string, error) {
+	releases, err := l.releases(ctx)
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, r := range releases {
+		v := strings.TrimPrefix(r.Version, "go")
+		if !r.Stable || !gover.IsValid(v) {
+			continue
+		}
+		if latest == "" || gover.Compare(v, latest) > 0 {
+			latest = v
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("%s: %w", l.source, ErrNoStableRelease)
+	}
+	return "go" + latest, nil
+}
+
+func (l *listing) releases(ctx context.Context) ([]Release, error) {
+	content, err := l.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var releases []Release
+	if err := json.Unmarshal(content, &releases); err != nil {
+		return nil, fmt.Errorf("%s: %w", l.source, err)
+	}
+	return releases, nil
+}
+
+func (l *listing) read(ctx context.Context) ([]byte, error) {
+	u, err := url.Parse(l.source)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if l.offline {
+			return nil, fmt.Errorf("%s: %w", l.source, ErrOffline)
+		}
+	case "file":
+		return os.ReadFile(u.Path)
+	default:
+		return os.ReadFile(l.source)
+	}
+
+	return l.retry.Get(ctx, l.log, l.net, request.NewRequestFactory(), l.source)
+}
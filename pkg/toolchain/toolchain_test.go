@@ -0,0 +1,99 @@
+package toolchain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MovieStoreGuy/versionist/pkg/request"
+)
+
+const listingJSON = `[
+	{"version": "go1.22rc1", "stable": false},
+	{"version": "go1.21.3", "stable": true},
+	{"version": "go1.20.10", "stable": true}
+]`
+
+func TestLatestToolchain(t *testing.T) {
+	t.Parallel()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(listingJSON))
+	}))
+	t.Cleanup(s.Close)
+
+	name := filepath.Join(t.TempDir(), "listing.json")
+	require.NoError(t, os.WriteFile(name, []byte(listingJSON), 0o644), "Must write listing")
+
+	for _, tc := range []struct {
+		scenario string
+		source   string
+	}{
+		{scenario: "http listing", source: s.URL},
+		{scenario: "file url listing", source: "file://" + filepath.ToSlash(name)},
+		{scenario: "local path listing", source: name},
+	} {
+		tc := tc
+		t.Run(tc.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			latest, err := NewResolver(WithListingSource(tc.source)).Latest(context.Background())
+			assert.NoError(t, err, "Must resolve the latest toolchain")
+			assert.Equal(t, "go1.21.3", latest, "Must use the newest stable release")
+		})
+	}
+}
+
+func TestNoStableToolchain(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "listing.json")
+	require.NoError(t, os.WriteFile(name, []byte(`[{"version": "go1.22rc1", "stable": false}]`), 0o644), "Must write listing")
+
+	_, err := NewResolver(WithListingSource(name)).Latest(context.Background())
+	assert.ErrorIs(t, err, ErrNoStableRelease, "Must error without a stable release")
+}
+
+func TestOfflineToolchain(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewResolver(WithOffline(true)).Latest(context.Background())
+	assert.ErrorIs(t, err, ErrOffline, "Must error when the listing requires the network")
+
+	name := filepath.Join(t.TempDir(), "listing.json")
+	require.NoError(t, os.WriteFile(name, []byte(listingJSON), 0o644), "Must write listing")
+
+	latest, err := NewResolver(WithOffline(true), WithListingSource(name)).Latest(context.Background())
+	assert.NoError(t, err, "Must read local listings while offline")
+	assert.Equal(t, "go1.21.3", latest, "Must use the newest stable release")
+}
+
+func TestRetryingToolchainListing(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(listingJSON))
+	}))
+	t.Cleanup(s.Close)
+
+	latest, err := NewResolver(
+		WithListingSource(s.URL),
+		WithRetryPolicy(request.RetryPolicy{Attempts: 2, Timeout: time.Second}),
+	).Latest(context.Background())
+	assert.NoError(t, err, "Must retry the failed listing request")
+	assert.Equal(t, "go1.21.3", latest, "Must use the newest stable release")
+	assert.EqualValues(t, 2, atomic.LoadInt32(&requests), "Must request the listing twice")
+}